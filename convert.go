@@ -1,43 +1,50 @@
 package lineschema
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"reflect"
-	"sort"
 	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cast"
-	"github.com/suifengpiao14/kvstruct"
+	"github.com/tidwall/gjson"
 )
 
-// Json2lineSchema
+// Json2lineSchema 根据json 案例推断lineschema,基本类型取json 类型(integer、number、boolean、string),规则同Json2lineSchemaFromSamples
 func Json2lineSchema(jsonStr string) (out *Lineschema, err error) {
-	out = &Lineschema{
-		Meta: &Meta{
-			Version: "http://json-schema.org/draft-07/schema#",
-			ID:      "example",
-		},
-		Items: make([]*LineschemaItem, 0),
-	}
-	var input interface{}
-	err = json.Unmarshal([]byte(jsonStr), &input)
-	if err != nil {
-		return nil, err
-	}
-	rv := reflect.Indirect(reflect.ValueOf(input))
-	items := parseOneJsonKey2Line(rv, "")
-	out.Items = items.Unique()
-	return out, nil
+	return Json2lineSchemaFromSamples([]string{jsonStr})
+}
+
+// Json2lineSchemaStringly 同Json2lineSchema,但基本类型均为string,通过format(int、float、boolean) 区分,用于har 中query 参数等值均为字符串的场景
+func Json2lineSchemaStringly(jsonStr string) (out *Lineschema, err error) {
+	return Json2lineSchemaFromSamples([]string{jsonStr}, withStringly())
 }
 
-// AssertBasicType 根据案例值（数组、对象不处理，只处理基本类型），推断lineschemaItem 的type 和format，次函数har解析时，Query部分需要在包外使用
+// AssertBasicType 根据案例值（数组、对象不处理，只处理基本类型），推断lineschemaItem 的type,返回的format 与type 一致(字符串格式由调用方识别)
 func AssertBasicType(rv reflect.Value) (typ string, format string, value any) {
+	typ, format, value = AssertStringlyBasicType(rv)
+	if typ != "string" {
+		return typ, format, value // null
+	}
+	switch format {
+	case "boolean":
+		typ = "boolean"
+	case "int":
+		typ = "integer"
+	case "float":
+		typ = "number"
+	}
+	return typ, typ, value
+}
+
+// AssertStringlyBasicType 根据案例值（数组、对象不处理，只处理基本类型），推断lineschemaItem 的type 和format,type 均为string,数字、布尔值通过format(int、float、boolean) 区分，此函数har解析时，Query部分需要在包外使用
+func AssertStringlyBasicType(rv reflect.Value) (typ string, format string, value any) {
 	rv = reflect.Indirect(rv)
 	kind := rv.Kind()
 	if kind == reflect.Interface {
 		rv = reflect.Indirect(rv.Elem())
+		kind = rv.Kind()
 	}
 	switch kind {
 	case reflect.Bool:
@@ -55,217 +62,458 @@ func AssertBasicType(rv reflect.Value) (typ string, format string, value any) {
 		value := rv.String()
 		return "string", "string", value
 	}
+	if !rv.IsValid() { // json null
+		return "null", "null", nil
+	}
 	return "null", "null", rv.Interface()
 }
 
-func parseOneJsonKey2Line(rv reflect.Value, fullname string) (items LineschemaItems) {
-	items = make([]*LineschemaItem, 0)
-	rv = reflect.Indirect(rv)
-	kind := rv.Kind()
-	switch kind {
-	case reflect.Array, reflect.Slice:
-		l := rv.Len()
-		if l == 0 {
-			item := &LineschemaItem{
-				Type:     "array",
-				Fullname: fmt.Sprintf("%s[]", fullname),
-				Example:  "[]",
-			}
-			items = append(items, item)
-			break
-		}
-		for i := 0; i < l; i++ {
-			v := rv.Index(i)
-			subFullname := fmt.Sprintf("%s[]", fullname)
-			subItems := parseOneJsonKey2Line(v, subFullname)
-			items = append(items, subItems...)
+// Jsonschema2Lineschema json schema 转 line schema,属性按其在json schema 中出现的顺序输出,保证结果稳定;$ref 引用的定义转换为自定义类型,
+// 默认只解析同一文档内的引用,引用其它文件或网络地址时需通过WithRefLoader 指定加载器
+func Jsonschema2Lineschema(jsonschema string, options ...Jsonschema2LineschemaOption) (lineschema *Lineschema, err error) {
+	if !gjson.Valid(jsonschema) {
+		err = errors.Errorf("invalid json schema: %s", jsonschema)
+		return nil, err
+	}
+	root := gjson.Parse(jsonschema)
+	meta := &Meta{
+		Version:     root.Get("$schema").String(),
+		ID:          root.Get("$id").String(),
+		Title:       root.Get("title").String(),
+		Description: root.Get("description").String(),
+		Extensions:  schemaExtensions(root),
+	}
+	if additional := root.Get("additionalProperties"); additional.Type == gjson.False && isEveryObjectClosed(root) {
+		meta.AdditionalProperties = additional.String()
+	}
+	if meta.ID == "" {
+		meta.ID = "example"
+	}
+	lineschema = &Lineschema{
+		Meta:  meta,
+		Items: make(LineschemaItems, 0),
+	}
+	converter := newJsonschemaConverter(root, lineschema, options...)
+	err = converter.convert()
+	if err != nil {
+		return nil, err
+	}
+	return lineschema, nil
+}
+
+// isEveryObjectClosed 判断json schema 中的对象(含定义)是否都声明了additionalProperties;
+// Meta.AdditionalProperties 会关闭所有对象,只关闭根节点的schema 不能映射为该属性
+func isEveryObjectClosed(root gjson.Result) bool {
+	paths := make([]string, 0)
+	collectObjectPaths(root, "", &paths)
+	for _, keyword := range []string{DRAFT_2020_12.DefinitionsKeyword(), DRAFT_07.DefinitionsKeyword()} {
+		root.Get(keyword).ForEach(func(key, schema gjson.Result) bool {
+			collectObjectPaths(schema, key.String(), &paths)
+			return true
+		})
+	}
+	return len(paths) == 0
+}
+
+// jsonschema2Items 深度优先遍历json schema,每个属性生成一行,fullname 为空表示根节点,不生成行(根节点引用自定义类型除外);base 为节点所在文档地址,用于解析相对引用
+func (c *jsonschemaConverter) jsonschema2Items(schema gjson.Result, fullname string, parentPairs []linePair, base string) (err error) {
+	isArrayObject := arraySuffixRegexp.MatchString(fullname) && schema.Get("properties").Exists() // 数组(元组)元素为对象时,由其属性行表达
+	isRef := isReference(schema)
+	if (fullname != "" && !isArrayObject) || isRef {
+		err = c.addSchemaItem(schema, fullname, parentPairs, base)
+		if err != nil {
+			return err
 		}
-	case reflect.Map:
-		iter := rv.MapRange()
-		for iter.Next() {
-			k := iter.Key().String()
-			subFullname := k
-			if fullname != "" {
-				subFullname = fmt.Sprintf("%s.%s", fullname, k)
-			}
-			subItems := parseOneJsonKey2Line(iter.Value(), subFullname)
-			sort.Sort(subItems)
-			items = append(items, subItems...)
+	}
+	return c.jsonschema2Children(schema, fullname, base)
+}
+
+// jsonschema2Children 遍历json schema 节点的子属性、数组元素
+func (c *jsonschemaConverter) jsonschema2Children(schema gjson.Result, fullname string, base string) (err error) {
+	childPairs := propertyPairs(schema)
+	schema.Get("properties").ForEach(func(key, property gjson.Result) bool {
+		subFullname := strings.Trim(fmt.Sprintf("%s.%s", fullname, key.String()), ".")
+		err = c.jsonschema2Items(property, subFullname, childPairs[key.String()], base)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+
+	items := schema.Get("items")
+	if items.IsObject() && !isReference(items) {
+		err = c.jsonschema2Items(items, fmt.Sprintf("%s[]", fullname), nil, base)
+		if err != nil {
+			return err
 		}
-	case reflect.Interface, reflect.Ptr:
-		rv = rv.Elem()
-		return parseOneJsonKey2Line(rv, fullname)
-	default: // 默认返回null,避免字段丢失
-		typ, format, value := AssertBasicType(rv)
-		if format == typ {
-			format = "" // 对应类型和格式一致的，忽略格式
+	}
+	tupleItems := schema.Get(DRAFT_2020_12.TupleItemsKeyword()) // 元组,draft-07 为items 数组
+	if items.IsArray() {
+		tupleItems = items
+	}
+	for i, element := range tupleItems.Array() {
+		if len(element.Map()) == 0 { // 未限制的位置
+			continue
 		}
-		item := &LineschemaItem{
-			Type:     typ,
-			Fullname: fullname,
-			Format:   format,
-			Example:  cast.ToString(value),
+		err = c.jsonschema2Items(element, fmt.Sprintf("%s[%d]", fullname, i), nil, base)
+		if err != nil {
+			return err
 		}
-		items = append(items, item)
 	}
-	for i := range items {
-		items[i].InitPath()
-	}
-	return items
+	return nil
 }
 
-// Jsonschema2Lineschema json schema 转 line schema
-func Jsonschema2Lineschema(jsonschema string) (lineschema *Lineschema, err error) {
-	var schema map[string]interface{}
-	err = json.Unmarshal([]byte(jsonschema), &schema)
-	if err != nil {
-		return nil, err
+// propertyPairs 父对象上描述子属性的属性:required、if/then 条件必填(requiredIf)、dependencies/dependentRequired 依赖必填
+func propertyPairs(schema gjson.Result) (childPairs map[string][]linePair) {
+	childPairs = make(map[string][]linePair)
+	for _, name := range schema.Get("required").Array() {
+		childPairs[name.String()] = append(childPairs[name.String()], linePair{Key: "required", Value: "true"})
 	}
-	kvs := jsonSchema2KVS(schema, "")
-	version, _ := kvs.GetFirstByKey("$schema")
-	id, _ := kvs.GetFirstByKey("$id")
-	if id.Value == "" {
-		id.Value = "example"
-	}
-	kvs1 := dealPropertiesAndItemsdealRequired(kvs)
-	kvs2 := dealRequired(kvs1)
-	m := make(map[string][][2]string)
-	for _, kv := range kvs2 {
-		if strings.HasPrefix(kv.Key, "$") {
+	for _, condition := range schema.Get(COMPOSITION_ALL_OF).Array() {
+		requiredIf, ok := requiredIfFromCondition(condition)
+		if !ok {
 			continue
 		}
-		lastDot := strings.LastIndex(strings.Trim(kv.Key, "."), ".")
-		fullname := ""
-		key := kv.Key
-		if lastDot > -1 {
-			fullname, key = kv.Key[:lastDot], kv.Key[lastDot+1:]
+		for _, name := range condition.Get("then.required").Array() {
+			childPairs[name.String()] = append(childPairs[name.String()], linePair{Key: "requiredIf", Value: requiredIf})
 		}
-		if _, ok := m[fullname]; !ok {
-			m[fullname] = make([][2]string, 0)
+	}
+	dependentFields := make(map[string][]string)
+	names := make([]string, 0)
+	for _, keyword := range []string{DRAFT_2020_12.DependentRequiredKeyword(), DRAFT_07.DependentRequiredKeyword()} {
+		schema.Get(keyword).ForEach(func(field, dependents gjson.Result) bool {
+			if !dependents.IsArray() { // draft-07 dependencies 的schema 形式不支持
+				return true
+			}
+			for _, name := range dependents.Array() {
+				if _, ok := dependentFields[name.String()]; !ok {
+					names = append(names, name.String())
+				}
+				dependentFields[name.String()] = append(dependentFields[name.String()], field.String())
+			}
+			return true
+		})
+	}
+	for _, name := range names {
+		value := dependentFields[name][0]
+		if len(dependentFields[name]) > 1 {
+			b, _ := json.Marshal(dependentFields[name])
+			value = string(b)
 		}
-
-		m[fullname] = append(m[fullname], [2]string{key, kv.Value})
+		childPairs[name] = append(childPairs[name], linePair{Key: "dependentRequired", Value: value})
 	}
+	return childPairs
+}
 
-	var w bytes.Buffer
-	w.WriteString(fmt.Sprintf("version=%s,id=%s\n", version.Value, id.Value))
-	for fullname, linePairs := range m {
-		if fullname == "" {
-			continue
-		}
-		pairs := make([]string, 0)
-		pairs = append(pairs, fmt.Sprintf("fullname=%s", fullname))
-		for _, pair := range linePairs {
-			pairs = append(pairs, strings.Join(pair[:], "="))
+// requiredIfFromCondition 从 {"if":{"properties":{"a":{"const":1}}},"then":{"required":[...]}} 中提取条件 {"a":1}
+func requiredIfFromCondition(condition gjson.Result) (requiredIf string, ok bool) {
+	properties := condition.Get("if.properties")
+	if !properties.IsObject() || !condition.Get("then.required").IsArray() || condition.Get("else").Exists() {
+		return "", false
+	}
+	values := make([]string, 0)
+	ok = true
+	properties.ForEach(func(key, property gjson.Result) bool {
+		value := property.Get("const")
+		if !value.Exists() {
+			ok = false
+			return false
 		}
-		w.WriteString(strings.Join(pairs, ","))
-		w.WriteString("\n")
+		values = append(values, fmt.Sprintf("%s:%s", key.Raw, value.Raw))
+		return true
+	})
+	if !ok || len(values) == 0 {
+		return "", false
 	}
+	return fmt.Sprintf("{%s}", strings.Join(values, ",")), true
+}
 
-	lineschemastr := w.String()
+// jsonschemaDefinition 将定义转换为自定义类型,对象类型生成"类型名.属性"行,其余生成类型别名行
+func (c *jsonschemaConverter) jsonschemaDefinition(definition refDefinition) (err error) {
+	if definition.schema.Get("properties").Exists() {
+		return c.jsonschema2Children(definition.schema, definition.name, definition.base)
+	}
+	return c.jsonschema2Items(definition.schema, definition.name, nil, definition.base)
+}
 
-	lineschema, err = ParseLineschema(lineschemastr)
+func (c *jsonschemaConverter) addSchemaItem(schema gjson.Result, fullname string, parentPairs []linePair, base string) (err error) {
+	typ, typePairs, err := c.schemaType(schema, fullname, base)
 	if err != nil {
-		return nil, err
+		return errors.WithMessagef(err, "fullname:%s", fullname)
+	}
+	pairs := schemaPairs(schema, fullname, typ, parentPairs)
+	pairs = append(pairs, typePairs...)
+	item, errs := kv2item(pairs)
+	if len(errs) > 0 {
+		err = errors.WithMessagef(errs, "fullname:%s", fullname)
+		return err
 	}
+	item.Lineschema = c.lineschema
+	c.lineschema.Items = append(c.lineschema.Items, item)
+	return nil
+}
 
-	return lineschema, nil
+// schemaType 获取json schema 节点对应的lineschema 类型,引用自定义类型时返回类型名,oneOf/anyOf/allOf 返回组合类型,additionalProperties/patternProperties 返回map 类型;typePairs 为类型附带的属性,如composition、keyPattern
+func (c *jsonschemaConverter) schemaType(schema gjson.Result, fullname string, base string) (typ string, typePairs []linePair, err error) {
+	if ref := schema.Get("$ref"); ref.Exists() {
+		typ, err = c.refTypeName(ref.String(), base)
+		return typ, nil, err
+	}
+	typ, typePairs, ok, err := c.compositeType(schema, fullname, base)
+	if ok || err != nil {
+		return typ, typePairs, err
+	}
+	if valueSchema, keyPattern, ok := mapValueSchema(schema); ok {
+		valueType, typePairs, err := c.valueType(valueSchema, fmt.Sprintf("%sValue", BaseName(fullname)), base)
+		if err != nil {
+			return "", nil, err
+		}
+		if keyPattern != "" {
+			typePairs = append(typePairs, linePair{Key: "keyPattern", Value: keyPattern})
+		}
+		return fmt.Sprintf("map[string]%s", valueType), typePairs, nil
+	}
+	typ, nullable := schemaTypeNullable(schema.Get("type"))
+	if nullable {
+		typePairs = append(typePairs, linePair{Key: "nullable", Value: "true"})
+	}
+	if typ != "array" {
+		return typ, typePairs, nil
+	}
+	items := schema.Get("items")
+	if ref := items.Get("$ref"); ref.Exists() {
+		name, err := c.refTypeName(ref.String(), base)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("[]%s", name), typePairs, nil
+	}
+	itemType, itemPairs, ok, err := c.compositeType(items, fmt.Sprintf("%s[]", fullname), base)
+	if ok || err != nil {
+		return fmt.Sprintf("[]%s", itemType), append(typePairs, itemPairs...), err
+	}
+	return typ, typePairs, nil
 }
 
-// jsonschema 转 kvs
-func jsonSchema2KVS(schema map[string]interface{}, prefix string) kvstruct.KVS {
-	kvs := kvstruct.KVS{}
-	for key, value := range schema {
-		fieldName := fmt.Sprintf("%s%s", prefix, key)
-		switch valueType := value.(type) {
-		case map[string]interface{}:
-			// 递归处理子对象
-			kvs.Add(jsonSchema2KVS(valueType, fieldName+".")...)
-		case string:
-			kvs.Add(kvstruct.KV{
-				Key:   fieldName,
-				Value: valueType,
-			})
-		case []interface{}:
-			b, _ := json.Marshal(value)
-			valueStr := string(b)
-			kvs.Add(kvstruct.KV{
-				Key:   fieldName,
-				Value: valueStr,
-			})
-		default:
-			kvs.Add(kvstruct.KV{
-				Key:   fieldName,
-				Value: cast.ToString(value),
-			})
+// schemaTypeNullable type 为数组(如["string","null"])时,取第一个非null 类型,包含null 时nullable 为true
+func schemaTypeNullable(typ gjson.Result) (typeName string, nullable bool) {
+	if !typ.IsArray() {
+		return typ.String(), false
+	}
+	for _, t := range typ.Array() {
+		if t.String() == "null" {
+			nullable = true
+		} else if typeName == "" {
+			typeName = t.String()
 		}
 	}
-	return kvs
+	if typeName == "" {
+		typeName = "string" // 只允许null 时按string 处理
+	}
+	return typeName, nullable
 }
 
-func dealPropertiesAndItemsdealRequired(kvs kvstruct.KVS) (newKvs kvstruct.KVS) {
-	newKvs = kvstruct.KVS{}
-	keywordItem := "items."
-	tmpKvs := make(kvstruct.KVS, 0)
-	for _, kv := range kvs {
-		segments := strings.Split(kv.Key, keywordItem)
-		prefix := ""
-		for i, segment := range segments {
-			parent := fmt.Sprintf("%s%s", prefix, segment)
-			parentType := fmt.Sprintf("%stype", parent)
-			parentTypeKv, _ := kvs.GetFirstByKey(parentType)
-			if parentTypeKv.Value == "array" {
-				segments[i] = "[]"
+// valueType map 值的类型,内联的对象、组合类型登记为自定义类型
+func (c *jsonschemaConverter) valueType(schema gjson.Result, name string, base string) (typ string, typePairs []linePair, err error) {
+	if schema.Get("properties").Exists() || isComposite(schema, COMPOSITION_ONE_OF) || isComposite(schema, COMPOSITION_ANY_OF) || isComposite(schema, COMPOSITION_ALL_OF) {
+		name = c.uniqueName(typeName(name))
+		c.definitions = append(c.definitions, refDefinition{name: name, base: base, schema: schema})
+		return name, nil, nil
+	}
+	typ, typePairs, err = c.schemaType(schema, name, base)
+	if itemType := schema.Get("items.type").String(); typ == "array" && itemType != "" {
+		typ = fmt.Sprintf("[]%s", itemType)
+	}
+	if typ == "" {
+		typ = "string"
+	}
+	return typ, typePairs, err
+}
+
+// mapValueSchema 没有properties 的对象,additionalProperties 为schema,或patternProperties 只有一个正则时,视为map 类型
+func mapValueSchema(schema gjson.Result) (valueSchema gjson.Result, keyPattern string, ok bool) {
+	if schema.Get("properties").Exists() {
+		return valueSchema, "", false
+	}
+	if additional := schema.Get("additionalProperties"); additional.IsObject() {
+		return additional, "", true
+	}
+	patternProperties := schema.Get("patternProperties").Map()
+	if len(patternProperties) != 1 {
+		return valueSchema, "", false
+	}
+	for pattern, valueSchema := range patternProperties {
+		return valueSchema, pattern, true
+	}
+	return valueSchema, "", false
+}
+
+// compositeType oneOf/anyOf/allOf 转换为组合类型,内联的子schema 登记为自定义类型
+func (c *jsonschemaConverter) compositeType(schema gjson.Result, fullname string, base string) (typ string, typePairs []linePair, ok bool, err error) {
+	for _, keyword := range []string{COMPOSITION_ONE_OF, COMPOSITION_ANY_OF, COMPOSITION_ALL_OF} {
+		if !isComposite(schema, keyword) {
+			continue
+		}
+		variants := make(map[int]gjson.Result)
+		indexes := make([]int, 0)
+		for i, variant := range schema.Get(keyword).Array() {
+			if isNullSchema(variant) { // {"type":"null"} 分支转换为nullable
+				typePairs = append(typePairs, linePair{Key: "nullable", Value: "true"})
+				continue
+			}
+			variants[i] = variant
+			indexes = append(indexes, i)
+		}
+		if len(typePairs) > 0 && len(indexes) == 1 { // 只有一个非null 分支,如 anyOf:[{$ref},{type:null}]
+			variant := variants[indexes[0]]
+			if ref := variant.Get("$ref"); ref.Exists() {
+				typ, err = c.refTypeName(ref.String(), base)
+				return typ, typePairs, err == nil, err
 			}
+			if variant.Get(COMPOSITION_ALL_OF).Exists() {
+				typ, allOfPairs, ok, err := c.compositeType(variant, fullname, base)
+				return typ, append(typePairs, allOfPairs...), ok, err
+			}
+		}
+		names := make([]string, 0)
+		for _, i := range indexes {
+			variant := variants[i]
+			if ref := variant.Get("$ref"); ref.Exists() {
+				name, err := c.refTypeName(ref.String(), base)
+				if err != nil {
+					return "", nil, false, err
+				}
+				names = append(names, name)
+				continue
+			}
+			name := c.uniqueName(fmt.Sprintf("%sVariant%d", typeName(BaseName(fullname)), i+1))
+			c.definitions = append(c.definitions, refDefinition{name: name, base: base, schema: variant})
+			names = append(names, name)
+		}
+		token := TOKEN_ONE_OF
+		switch keyword {
+		case COMPOSITION_ANY_OF:
+			typePairs = append(typePairs, linePair{Key: "composition", Value: COMPOSITION_ANY_OF})
+		case COMPOSITION_ALL_OF:
+			token = TOKEN_ALL_OF
 		}
-		key := strings.Join(segments, "")
-		tmpKvs.Add(kvstruct.KV{Key: key, Value: kv.Value})
+		return strings.Join(names, token), typePairs, true, nil
 	}
+	return "", nil, false, nil
+}
 
-	keywordProperties := "properties."
-	for _, kv := range kvs {
-		segments := strings.Split(kv.Key, keywordProperties)
-		prefix := ""
-		for i, segment := range segments {
-			parent := fmt.Sprintf("%s%s", prefix, segment)
-			parentType := fmt.Sprintf("%stype", parent)
-			parentTypeKv, _ := kvs.GetFirstByKey(parentType)
-			if parentTypeKv.Value == "object" {
-				segments[i] = ""
-			}
+// isNullSchema 是否为 {"type":"null"}
+func isNullSchema(schema gjson.Result) bool {
+	return schema.Get("type").String() == "null" && len(schema.Map()) == 1
+}
+
+// isComposite 节点是否为组合类型,oneOf 用于枚举标题(const+title) 时除外
+func isComposite(schema gjson.Result, keyword string) bool {
+	variants := schema.Get(keyword)
+	if !variants.IsArray() || len(variants.Array()) == 0 {
+		return false
+	}
+	if _, isEnumNames := enumNamesFromOneOf(variants); keyword == COMPOSITION_ONE_OF && isEnumNames {
+		return false
+	}
+	for _, variant := range variants.Array() {
+		if variant.Get("if").Exists() { // 条件必填(if/then),非组合类型
+			return false
 		}
-		key := strings.Join(segments, "")
-		newKvs.Add(kvstruct.KV{Key: key, Value: kv.Value})
 	}
-	return newKvs
+	return true
 }
 
-func dealRequired(kvs kvstruct.KVS) (newKvs kvstruct.KVS) {
-	newKvs = make(kvstruct.KVS, 0)
+// isReference 节点是否引用自定义类型($ref 或组合类型)
+func isReference(schema gjson.Result) bool {
+	if schema.Get("$ref").Exists() {
+		return true
+	}
+	for _, keyword := range []string{COMPOSITION_ONE_OF, COMPOSITION_ANY_OF, COMPOSITION_ALL_OF} {
+		if isComposite(schema, keyword) {
+			return true
+		}
+	}
+	return false
+}
 
-	for _, kv := range kvs {
-		requiredLastIndex := strings.LastIndex(kv.Key, "required")
-		if requiredLastIndex < 0 {
-			newKvs.Add(kv)
-			continue
+// schemaPairs 提取json schema 节点上lineschema 支持的属性
+func schemaPairs(schema gjson.Result, fullname string, typ string, parentPairs []linePair) (pairs []linePair) {
+	pairs = []linePair{{Key: "fullname", Value: fullname}}
+	if typ != "" {
+		pairs = append(pairs, linePair{Key: "type", Value: typ})
+	}
+	pairs = append(pairs, parentPairs...)
+	schema.ForEach(func(key, value gjson.Result) bool {
+		k := key.String()
+		switch k {
+		case "type", "required", "path", "properties", "items", "$ref", "$defs", "definitions", "dependentRequired":
+			return true
+		case "exclusiveMaximum", "exclusiveMinimum": // 数字形式(draft-06 起)转成 maximum/minimum+布尔标记
+			if value.Type == gjson.Number {
+				boundKey := map[string]string{"exclusiveMaximum": "maximum", "exclusiveMinimum": "minimum"}[k]
+				pairs = append(pairs, linePair{Key: boundKey, Value: value.Raw}, linePair{Key: k, Value: "true"})
+				return true
+			}
+		case "additionalProperties": // 对象形式为map 值类型,在schemaType 中处理
+			if value.Type != gjson.True && value.Type != gjson.False {
+				return true
+			}
+		case "discriminator": // OpenAPI 风格 {"propertyName":"kind"}
+			if propertyName := value.Get("propertyName").String(); propertyName != "" {
+				pairs = append(pairs, linePair{Key: k, Value: propertyName})
+			}
+			return true
+		case "oneOf": // 枚举标题
+			enumNames, ok := enumNamesFromOneOf(value)
+			if ok && !schema.Get("enumNames").Exists() {
+				pairs = append(pairs, linePair{Key: "enumNames", Value: enumNames})
+			}
+			return true
+		}
+		if !isToken(k) {
+			return true
 		}
-		prefix := kv.Key[:requiredLastIndex]
-		typeKv, _ := kvs.GetFirstByKey(fmt.Sprintf("%stype", prefix))
-		if typeKv.Value != "array" && typeKv.Value != "object" {
-			newKvs.Add(kv)
+		pairs = append(pairs, linePair{Key: k, Value: schemaValue(value)})
+		return true
+	})
+	return pairs
+}
+
+// enumNamesFromOneOf 从oneOf:[{const,title}] 中提取枚举标题
+func enumNamesFromOneOf(oneOf gjson.Result) (enumNames string, ok bool) {
+	names := make([]string, 0)
+	for _, one := range oneOf.Array() {
+		if isNullSchema(one) { // 可为null 时增加的分支
 			continue
 		}
-		var keys = make([]string, 0)
-		err := json.Unmarshal([]byte(kv.Value), &keys)
-		if err != nil {
-			panic(err)
+		if !one.Get("const").Exists() {
+			return "", false
 		}
-		for _, k := range keys {
-			newKvs.Add(kvstruct.KV{
-				Key:   fmt.Sprintf("%s%s.required", prefix, k),
-				Value: "true",
-			})
+		names = append(names, one.Get("title").String())
+	}
+	b, _ := json.Marshal(names)
+	return string(b), len(names) > 0
+}
+
+// schemaExtensions 提取json schema 节点上的扩展属性
+func schemaExtensions(schema gjson.Result) (extensions Extensions) {
+	schema.ForEach(func(key, value gjson.Result) bool {
+		if IsExtensionKey(key.String()) {
+			if extensions == nil {
+				extensions = make(Extensions)
+			}
+			extensions[key.String()] = schemaValue(value)
 		}
+		return true
+	})
+	return extensions
+}
+
+// schemaValue json schema 属性值转lineschema 属性值,数组、对象保留json 格式,数字保留原始文本,避免精度损失
+func schemaValue(value gjson.Result) (s string) {
+	if value.IsArray() || value.IsObject() || value.Type == gjson.Number {
+		return value.Raw
 	}
-	return newKvs
+	return value.String()
 }
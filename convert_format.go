@@ -0,0 +1,99 @@
+package lineschema
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FORMAT_DATE_TIME = "date-time"
+	FORMAT_DATE      = "date"
+	FORMAT_EMAIL     = "email"
+	FORMAT_UUID      = "uuid"
+	FORMAT_URI       = "uri"
+	FORMAT_IPV4      = "ipv4"
+	FORMAT_MOBILE    = "mobile" // 中国大陆手机号,非json schema 标准格式
+)
+
+// FormatDetector 根据字符串案例识别格式
+type FormatDetector struct {
+	Format string
+	Match  func(value string) bool
+}
+
+var (
+	uuidRegexp   = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	emailRegexp  = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	mobileRegexp = regexp.MustCompile(`^(\+?86)?1[3-9]\d{9}$`)
+)
+
+var (
+	formatDetectorsMu sync.RWMutex
+	// formatDetectors 按顺序匹配,先匹配的优先
+	formatDetectors = []FormatDetector{
+		{Format: FORMAT_UUID, Match: uuidRegexp.MatchString},
+		{Format: FORMAT_DATE_TIME, Match: func(value string) bool {
+			_, err := time.Parse(time.RFC3339, value)
+			return err == nil
+		}},
+		{Format: FORMAT_DATE, Match: func(value string) bool {
+			_, err := time.Parse("2006-01-02", value)
+			return err == nil
+		}},
+		{Format: FORMAT_EMAIL, Match: emailRegexp.MatchString},
+		{Format: FORMAT_URI, Match: func(value string) bool {
+			u, err := url.Parse(value)
+			return err == nil && u.Scheme != "" && u.Host != ""
+		}},
+		{Format: FORMAT_IPV4, Match: func(value string) bool {
+			ip := net.ParseIP(value)
+			return ip != nil && ip.To4() != nil && strings.Count(value, ".") == 3
+		}},
+		{Format: FORMAT_MOBILE, Match: mobileRegexp.MatchString},
+	}
+)
+
+// RegisterFormatDetector 注册格式识别器,已存在同名格式时替换原识别器,否则新识别器优先于已有识别器匹配
+func RegisterFormatDetector(format string, match func(value string) bool) {
+	formatDetectorsMu.Lock()
+	defer formatDetectorsMu.Unlock()
+	for i := range formatDetectors {
+		if formatDetectors[i].Format == format {
+			formatDetectors[i].Match = match
+			return
+		}
+	}
+	formatDetectors = append([]FormatDetector{{Format: format, Match: match}}, formatDetectors...)
+}
+
+// UnregisterFormatDetector 移除格式识别器
+func UnregisterFormatDetector(format string) {
+	formatDetectorsMu.Lock()
+	defer formatDetectorsMu.Unlock()
+	detectors := make([]FormatDetector, 0, len(formatDetectors))
+	for _, detector := range formatDetectors {
+		if detector.Format != format {
+			detectors = append(detectors, detector)
+		}
+	}
+	formatDetectors = detectors
+}
+
+// DetectFormat 识别字符串案例的格式,无法识别时返回空
+func DetectFormat(value string) (format string) {
+	if value == "" {
+		return ""
+	}
+	formatDetectorsMu.RLock()
+	defer formatDetectorsMu.RUnlock()
+	for _, detector := range formatDetectors {
+		if detector.Match(value) {
+			return detector.Format
+		}
+	}
+	return ""
+}
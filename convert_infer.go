@@ -0,0 +1,353 @@
+package lineschema
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+// Json2lineSchemaFromSamples 根据多个json 案例推断lineschema:属性在其父对象的每个案例中都出现时才标记为必填,
+// 同一属性类型不一致时放宽类型(integer、number 合并为number,其它基本类型不限制类型,即TYPE_ANY),出现null 时标记nullable;
+// 字符串案例通过DetectFormat 识别格式,所有案例格式一致时设置format;开启WithProfile 后根据案例推断取值范围等约束
+func Json2lineSchemaFromSamples(samples []string, options ...InferOption) (out *Lineschema, err error) {
+	option := newInferOption(options...)
+	root := newSampleNode("", option)
+	for i, sample := range samples {
+		if !gjson.Valid(sample) {
+			err = errors.Errorf("invalid json sample %d: %s", i+1, sample)
+			return nil, err
+		}
+		root.observe(gjson.Parse(sample))
+	}
+	out = &Lineschema{
+		Meta: &Meta{
+			Version: "http://json-schema.org/draft-07/schema#",
+			ID:      "example",
+		},
+		Items: make(LineschemaItems, 0),
+	}
+	root.addItems(&out.Items)
+	for _, item := range out.Items {
+		item.Lineschema = out
+	}
+	return out, nil
+}
+
+// JsonLines2lineSchema 从json lines(每行一个json 案例,空行忽略)推断lineschema,规则同Json2lineSchemaFromSamples
+func JsonLines2lineSchema(r io.Reader, options ...InferOption) (out *Lineschema, err error) {
+	samples := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		samples = append(samples, line)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return Json2lineSchemaFromSamples(samples, options...)
+}
+
+// InferOption 案例推断选项
+type InferOption func(o *inferOption)
+
+type inferOption struct {
+	profile   bool
+	enumLimit int
+	stringly  bool // 基本类型均输出为string,通过format 区分,见Json2lineSchemaStringly
+}
+
+// INFER_ENUM_LIMIT 推断枚举时,不同取值的默认最大数量
+const INFER_ENUM_LIMIT = 5
+
+func newInferOption(options ...InferOption) (o *inferOption) {
+	o = &inferOption{
+		enumLimit: INFER_ENUM_LIMIT,
+	}
+	for _, option := range options {
+		option(o)
+	}
+	return o
+}
+
+// WithProfile 根据案例推断约束:数字的minimum、maximum,字符串的minLength、maxLength,数组的minItems、maxItems,
+// 以及取值较少的enum(不同取值不超过enumLimit 且有重复取值,enumLimit<=0 时使用INFER_ENUM_LIMIT)
+func WithProfile(enumLimit int) InferOption {
+	return func(o *inferOption) {
+		o.profile = true
+		if enumLimit > 0 {
+			o.enumLimit = enumLimit
+		}
+	}
+}
+
+// withStringly 基本类型均输出为string,数字、布尔值通过format(int、float、boolean) 区分
+func withStringly() InferOption {
+	return func(o *inferOption) {
+		o.stringly = true
+	}
+}
+
+// stringlyFormats 基本类型输出为string 时对应的format
+var stringlyFormats = map[string]string{
+	"integer": "int",
+	"number":  "float",
+	"boolean": "boolean",
+}
+
+// sampleNode 多个案例中同一位置(fullname)的观察结果
+type sampleNode struct {
+	fullname   string
+	types      map[string]int // 出现的json 类型(object、array、string、integer、number、boolean)及次数
+	nullable   bool
+	example    string
+	format     string // 字符串案例识别出的格式,各案例不一致时为空
+	count      int    // 作为对象属性出现的次数
+	objects    int    // 作为对象出现的次数,子属性出现次数与之相等时必填
+	children   []*sampleNode
+	childIndex map[string]*sampleNode
+	option     *inferOption
+	profile    *sampleProfile
+}
+
+// sampleProfile 开启WithProfile 时记录的统计信息
+type sampleProfile struct {
+	minimum, maximum     string // 数字原始文本,不损失精度
+	minValue, maxValue   float64
+	minLength, maxLength int
+	strings              int // 字符串案例数
+	minItems, maxItems   int
+	arrays               int      // 数组案例数
+	scalars              int      // 基本类型案例数
+	enum                 []string // 不同取值(json 文本),按出现顺序
+	enumOverflow         bool     // 不同取值超过限制
+}
+
+func newSampleNode(fullname string, option *inferOption) *sampleNode {
+	n := &sampleNode{
+		fullname:   fullname,
+		types:      make(map[string]int),
+		childIndex: make(map[string]*sampleNode),
+		option:     option,
+	}
+	if option.profile {
+		n.profile = &sampleProfile{}
+	}
+	return n
+}
+
+// child 获取子节点,按首次出现的顺序记录;数组元素的name 为[]
+func (n *sampleNode) child(name string) (child *sampleNode) {
+	if child, ok := n.childIndex[name]; ok {
+		return child
+	}
+	fullname := joinKey(n.fullname, name)
+	if name == "[]" {
+		fullname = n.fullname + name
+	}
+	child = newSampleNode(fullname, n.option)
+	n.childIndex[name] = child
+	n.children = append(n.children, child)
+	return child
+}
+
+func (n *sampleNode) observe(value gjson.Result) {
+	switch value.Type {
+	case gjson.Null:
+		n.nullable = true
+	case gjson.True, gjson.False:
+		n.addScalar("boolean", value.Raw)
+	case gjson.Number:
+		typ := "integer"
+		if strings.ContainsAny(value.Raw, ".eE") {
+			typ = "number"
+		}
+		n.addScalar(typ, value.Raw)
+		if n.profile != nil {
+			n.profile.observeNumber(value.Raw)
+		}
+	case gjson.String:
+		n.addScalar("string", value.String())
+		if n.profile != nil {
+			n.profile.observeString(value.String())
+		}
+	case gjson.JSON:
+		if value.IsArray() {
+			elements := value.Array()
+			if n.profile != nil {
+				n.profile.observeItems(len(elements))
+			}
+			n.types["array"]++
+			for _, element := range elements {
+				n.child("[]").observe(element)
+			}
+			break
+		}
+		n.types["object"]++
+		n.objects++
+		value.ForEach(func(key, v gjson.Result) bool {
+			child := n.child(key.String())
+			child.count++
+			child.observe(v)
+			return true
+		})
+	}
+}
+
+func (n *sampleNode) addScalar(typ string, example string) {
+	if len(n.types) == 0 {
+		n.example = example
+	}
+	if typ == "string" {
+		format := DetectFormat(example)
+		if n.types[typ] == 0 {
+			n.format = format
+		} else if n.format != format {
+			n.format = ""
+		}
+	}
+	n.types[typ]++
+	if n.profile != nil {
+		raw := example
+		if typ == "string" {
+			b, _ := json.Marshal(example)
+			raw = string(b)
+		}
+		n.profile.observeEnum(raw, n.option.enumLimit)
+	}
+}
+
+func (p *sampleProfile) observeNumber(raw string) {
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return
+	}
+	if p.minimum == "" || value < p.minValue {
+		p.minimum, p.minValue = raw, value
+	}
+	if p.maximum == "" || value > p.maxValue {
+		p.maximum, p.maxValue = raw, value
+	}
+}
+
+func (p *sampleProfile) observeString(value string) {
+	length := utf8.RuneCountInString(value)
+	if p.strings == 0 || length < p.minLength {
+		p.minLength = length
+	}
+	if length > p.maxLength {
+		p.maxLength = length
+	}
+	p.strings++
+}
+
+func (p *sampleProfile) observeItems(length int) {
+	if p.arrays == 0 || length < p.minItems {
+		p.minItems = length
+	}
+	if length > p.maxItems {
+		p.maxItems = length
+	}
+	p.arrays++
+}
+
+func (p *sampleProfile) observeEnum(raw string, limit int) {
+	p.scalars++
+	if p.enumOverflow {
+		return
+	}
+	for _, value := range p.enum {
+		if value == raw {
+			return
+		}
+	}
+	if len(p.enum) >= limit {
+		p.enumOverflow, p.enum = true, nil
+		return
+	}
+	p.enum = append(p.enum, raw)
+}
+
+// apply 将统计出的约束写入item,类型不一致(已放宽)时不写入与原类型相关的约束
+func (p *sampleProfile) apply(item *LineschemaItem, types map[string]int) {
+	switch item.Type {
+	case "integer", "number":
+		item.Minimum, item.Maximum = json.Number(p.minimum), json.Number(p.maximum)
+	case "string":
+		if len(types) == 1 && types["string"] > 0 {
+			item.MinLength, item.MaxLength = p.minLength, p.maxLength
+		}
+	case "array":
+		item.MinItems, item.MaxItems = p.minItems, p.maxItems
+	}
+	isEnumType := len(types) == 1 && (types["string"] > 0 || types["integer"] > 0 || types["number"] > 0)
+	if isEnumType && !p.enumOverflow && len(p.enum) > 0 && len(p.enum) < p.scalars {
+		item.Enum = fmt.Sprintf("[%s]", strings.Join(p.enum, ","))
+	}
+}
+
+// typ 合并后的类型:出现过对象、数组时取对象、数组(子属性才能被描述),基本类型不一致时放宽(无法合并时不限制类型),只有null 时按string 处理
+func (n *sampleNode) typ() string {
+	switch {
+	case n.types["object"] > 0:
+		return "object"
+	case n.types["array"] > 0:
+		return "array"
+	case len(n.types) == 0:
+		return "string"
+	case len(n.types) == 1:
+		for typ := range n.types {
+			return typ
+		}
+	case len(n.types) == 2 && n.types["integer"] > 0 && n.types["number"] > 0:
+		return "number"
+	}
+	return TYPE_ANY
+}
+
+// addItems 深度优先输出子节点,对象、数组只在必填、可为null 或没有子属性时单独输出一行
+func (n *sampleNode) addItems(items *LineschemaItems) {
+	for _, child := range n.children {
+		typ := child.typ()
+		isElement := strings.HasSuffix(child.fullname, "[]")
+		required := !isElement && n.objects > 0 && child.count == n.objects
+		isContainer := typ == "object" || typ == "array"
+		hasProfile := child.profile != nil && typ == "array"
+		if !isContainer || required || child.nullable || len(child.children) == 0 || hasProfile {
+			item := &LineschemaItem{
+				Fullname: child.fullname,
+				Type:     typ,
+				Required: required,
+				Nullable: child.nullable,
+			}
+			if !isContainer {
+				item.Example = child.example
+			}
+			if len(child.types) == 1 && child.types["string"] > 0 {
+				item.Format = child.format
+			}
+			if child.profile != nil {
+				child.profile.apply(item, child.types)
+			}
+			if n.option.stringly && !isContainer {
+				item.Type = "string"
+				if format, ok := stringlyFormats[typ]; ok {
+					item.Format = format
+				}
+			}
+			item.InitPath()
+			*items = append(*items, item)
+		}
+		child.addItems(items)
+	}
+}
@@ -0,0 +1,260 @@
+package lineschema
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+// ERROR_REF_NOT_FOUND $ref 指向的节点不存在
+var ERROR_REF_NOT_FOUND = errors.New("json schema $ref not found")
+
+// ERROR_REF_LOADER_REQUIRED 引用了外部文档,但未通过WithRefLoader 指定加载器
+var ERROR_REF_LOADER_REQUIRED = errors.New("external json schema $ref requires WithRefLoader")
+
+// RefLoader 加载$ref 引用的外部json schema 文档,uri 为相对根文档解析后的地址
+type RefLoader func(uri string) (schema []byte, err error)
+
+// REF_HTTP_TIMEOUT DefaultRefLoader 通过网络获取文档的超时时间
+const REF_HTTP_TIMEOUT = 10 * time.Second
+
+var refHTTPClient = &http.Client{Timeout: REF_HTTP_TIMEOUT}
+
+// DefaultRefLoader http(s) 地址通过网络获取,其余按本地文件读取;会访问网络和本地文件,只应对可信的schema 通过WithRefLoader 启用
+func DefaultRefLoader(uri string) (schema []byte, err error) {
+	if strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://") {
+		rsp, err := refHTTPClient.Get(uri)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		defer rsp.Body.Close()
+		if rsp.StatusCode != http.StatusOK {
+			return nil, errors.Errorf("load %s: http status %d", uri, rsp.StatusCode)
+		}
+		schema, err = io.ReadAll(rsp.Body)
+		return schema, errors.WithStack(err)
+	}
+	schema, err = os.ReadFile(strings.TrimPrefix(uri, "file://"))
+	return schema, errors.WithStack(err)
+}
+
+// Jsonschema2LineschemaOption json schema 转lineschema 选项
+type Jsonschema2LineschemaOption func(o *jsonschema2LineschemaOption)
+
+type jsonschema2LineschemaOption struct {
+	loader  RefLoader
+	baseURI string
+}
+
+// WithRefLoader 指定外部$ref 文档加载器,如测试时从内存加载;未指定时只解析同一文档内的引用
+func WithRefLoader(loader RefLoader) Jsonschema2LineschemaOption {
+	return func(o *jsonschema2LineschemaOption) {
+		o.loader = loader
+	}
+}
+
+// WithBaseURI 指定根文档地址,相对文件引用基于此地址解析,默认取根节点$id(需为带协议的地址)
+func WithBaseURI(baseURI string) Jsonschema2LineschemaOption {
+	return func(o *jsonschema2LineschemaOption) {
+		o.baseURI = baseURI
+	}
+}
+
+// refDefinition $ref 指向的定义,转换为自定义类型
+type refDefinition struct {
+	name   string
+	base   string // 定义所在文档地址
+	schema gjson.Result
+}
+
+// jsonschemaConverter 记录转换过程中已加载的文档及引用与自定义类型名的对应关系
+type jsonschemaConverter struct {
+	root        gjson.Result
+	lineschema  *Lineschema
+	option      *jsonschema2LineschemaOption
+	documents   map[string]gjson.Result // 文档地址->文档
+	names       map[string]string       // 规范化引用->类型名
+	usedNames   map[string]bool
+	definitions []refDefinition // 待输出的定义,按发现顺序
+}
+
+func newJsonschemaConverter(root gjson.Result, lineschema *Lineschema, options ...Jsonschema2LineschemaOption) (c *jsonschemaConverter) {
+	option := &jsonschema2LineschemaOption{}
+	if id, err := url.Parse(root.Get("$id").String()); err == nil && id.Scheme != "" {
+		option.baseURI = id.String()
+	}
+	for _, o := range options {
+		o(option)
+	}
+	c = &jsonschemaConverter{
+		root:       root,
+		lineschema: lineschema,
+		option:     option,
+		documents:  map[string]gjson.Result{option.baseURI: root},
+		names:      make(map[string]string),
+		usedNames:  make(map[string]bool),
+	}
+	return c
+}
+
+func (c *jsonschemaConverter) convert() (err error) {
+	c.root.Get("properties").ForEach(func(key, _ gjson.Result) bool {
+		c.usedNames[key.String()] = true // 类型名不能与顶层属性同名
+		return true
+	})
+	// 根文档$defs(definitions) 中的定义即使未被引用也输出,类型名规则同refTypeName(首字母大写,不与基本类型、顶层属性重名)
+	for _, keyword := range []string{DRAFT_2020_12.DefinitionsKeyword(), DRAFT_07.DefinitionsKeyword()} {
+		c.root.Get(keyword).ForEach(func(key, schema gjson.Result) bool {
+			name := c.uniqueName(typeName(key.String()))
+			c.names[fmt.Sprintf("%s#/%s/%s", c.option.baseURI, keyword, jsonPointerEscaper.Replace(key.String()))] = name
+			c.definitions = append(c.definitions, refDefinition{name: name, base: c.option.baseURI, schema: schema})
+			return true
+		})
+	}
+	err = c.jsonschema2Items(c.root, "", nil, c.option.baseURI)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(c.definitions); i++ { // 输出定义时可能发现新的引用,追加到队尾
+		err = c.jsonschemaDefinition(c.definitions[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refTypeName 解析$ref,返回对应的自定义类型名,首次遇到的引用登记为待输出的定义
+func (c *jsonschemaConverter) refTypeName(ref string, base string) (name string, err error) {
+	file, fragment, _ := strings.Cut(ref, "#")
+	uri := resolveURI(base, file)
+	key := fmt.Sprintf("%s#%s", uri, fragment)
+	if name, ok := c.names[key]; ok {
+		return name, nil
+	}
+	document, err := c.document(uri)
+	if err != nil {
+		return "", err
+	}
+	schema, err := jsonPointer(document, fragment)
+	if err != nil {
+		return "", errors.WithMessagef(err, "$ref:%s", ref)
+	}
+	name = c.uniqueName(refName(uri, fragment))
+	c.names[key] = name
+	c.definitions = append(c.definitions, refDefinition{name: name, base: uri, schema: schema})
+	return name, nil
+}
+
+// document 获取文档,外部文档通过加载器加载后缓存
+func (c *jsonschemaConverter) document(uri string) (document gjson.Result, err error) {
+	if document, ok := c.documents[uri]; ok {
+		return document, nil
+	}
+	if c.option.loader == nil {
+		return document, errors.WithMessagef(ERROR_REF_LOADER_REQUIRED, "$ref document:%s", uri)
+	}
+	b, err := c.option.loader(uri)
+	if err != nil {
+		return document, errors.WithMessagef(err, "load $ref document:%s", uri)
+	}
+	if !gjson.ValidBytes(b) {
+		return document, errors.Errorf("invalid json schema document: %s", uri)
+	}
+	document = gjson.ParseBytes(b)
+	c.documents[uri] = document
+	return document, nil
+}
+
+// uniqueName 类型名冲突时追加序号
+func (c *jsonschemaConverter) uniqueName(name string) (unique string) {
+	unique = name
+	for i := 2; c.usedNames[unique]; i++ {
+		unique = fmt.Sprintf("%s%d", name, i)
+	}
+	c.usedNames[unique] = true
+	return unique
+}
+
+// resolveURI 基于base 解析相对地址,file 为空表示base 文档本身
+func resolveURI(base string, file string) (uri string) {
+	if file == "" {
+		return base
+	}
+	fileURL, err := url.Parse(file)
+	if err == nil && fileURL.Scheme != "" {
+		return file
+	}
+	baseURL, err := url.Parse(base)
+	if err == nil && baseURL.Scheme != "" {
+		return baseURL.ResolveReference(fileURL).String()
+	}
+	if path.IsAbs(file) {
+		return file
+	}
+	return path.Join(path.Dir(base), file)
+}
+
+// jsonPointer 按json pointer(如 /definitions/Address) 获取节点
+func jsonPointer(document gjson.Result, pointer string) (node gjson.Result, err error) {
+	pointer, err = url.PathUnescape(pointer)
+	if err != nil {
+		return node, errors.WithStack(err)
+	}
+	node = document
+	if pointer == "" || pointer == "/" {
+		return node, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return node, errors.Errorf("unsupported json pointer: %s", pointer)
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		node = node.Get(gjsonPathEscaper.Replace(token))
+		if !node.Exists() {
+			return node, errors.WithMessagef(ERROR_REF_NOT_FOUND, "pointer:%s", pointer)
+		}
+	}
+	return node, nil
+}
+
+var gjsonPathEscaper = strings.NewReplacer(
+	`\`, `\\`, ".", `\.`, "*", `\*`, "?", `\?`, "|", `\|`, "#", `\#`, "@", `\@`, "!", `\!`, "=", `\=`, "<", `\<`, ">", `\>`, "%", `\%`,
+)
+
+var typeNameRegexp = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// refName 由引用地址生成类型名,优先取json pointer 最后一段,否则取文件名
+func refName(uri string, fragment string) (name string) {
+	tokens := strings.Split(strings.Trim(fragment, "/"), "/")
+	name = strings.NewReplacer("~1", "/", "~0", "~").Replace(tokens[len(tokens)-1])
+	if name == "" {
+		name = strings.TrimSuffix(path.Base(uri), path.Ext(uri))
+	}
+	return typeName(name)
+}
+
+// jsonPointerEscaper 转义json pointer 中的一段,与refName 中的反转义对应
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// typeName 将名称转换为合法的自定义类型名
+func typeName(name string) string {
+	name = strings.Trim(typeNameRegexp.ReplaceAllString(name, "_"), "_")
+	if name == "" {
+		name = "Root"
+	}
+	name = strings.ToUpper(name[:1]) + name[1:] // 类型名首字母大写,与属性名区分
+	if _, ok := CustomDefineStruct(name); !ok { // 与基本类型重名
+		name = fmt.Sprintf("Ref_%s", name)
+	}
+	return name
+}
@@ -1,10 +1,15 @@
 package lineschema_test
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/require"
 	"github.com/suifengpiao14/lineschema"
+	"github.com/tidwall/gjson"
+	"github.com/xeipuuv/gojsonschema"
 )
 
 func TestJsonExample(t *testing.T) {
@@ -53,3 +58,650 @@ func TestJson2Lineschema(t *testing.T) {
 	}
 	fmt.Println(lineschema.String())
 }
+
+func TestExtensions(t *testing.T) {
+	raw := `version=http://json-schema.org/draft-07/schema#,id=in,x-table=orders
+fullname=userId,type=int,required,x-db-column=user_id,x-ui={"widget":"select"}
+fullname=name,x-mask=true`
+	ls, err := lineschema.ParseLineschema(raw, lineschema.WithStrict())
+	require.NoError(t, err)
+	require.Equal(t, "user_id", ls.Items[0].Extensions["x-db-column"])
+	require.Equal(t, "orders", ls.Meta.Extensions["x-table"])
+
+	ls2, err := lineschema.ParseLineschema(ls.String())
+	require.NoError(t, err)
+	require.Equal(t, ls.String(), ls2.String())
+
+	jsonschema, err := ls.JsonSchema()
+	require.NoError(t, err)
+	require.Equal(t, "orders", gjson.GetBytes(jsonschema, "x-table").String())
+	require.Equal(t, "user_id", gjson.GetBytes(jsonschema, "properties.userId.x-db-column").String())
+	require.Equal(t, "select", gjson.GetBytes(jsonschema, "properties.userId.x-ui.widget").String())
+
+	ls3, err := lineschema.Jsonschema2Lineschema(string(jsonschema))
+	require.NoError(t, err)
+	require.Equal(t, "orders", ls3.Meta.Extensions["x-table"])
+	item, ok := ls3.Items.GetByFullName("userId")
+	require.True(t, ok)
+	require.Equal(t, "user_id", item.Extensions["x-db-column"])
+	require.JSONEq(t, `{"widget":"select"}`, item.Extensions["x-ui"])
+}
+
+func TestJsonschema2LineschemaOrder(t *testing.T) {
+	jsonschema := `{"$schema":"http://json-schema.org/draft-07/schema#","$id":"out","type":"object","required":["code","items"],"properties":{"code":{"type":"string","format":"int"},"message":{"type":"string","title":"业务提示, 描述"},"items":{"type":"array","items":{"type":"object","required":["id"],"properties":{"id":{"type":"string","format":"int"},"tags":{"type":"array","items":{"type":"string"}}}}},"pagination":{"type":"object","properties":{"size":{"type":"int"},"index":{"type":"int"}}}}}`
+	ls, err := lineschema.Jsonschema2Lineschema(jsonschema)
+	require.NoError(t, err)
+	fullnames := itemFullnames(ls.Items)
+	require.Equal(t, []string{"code", "message", "items", "items[].id", "items[].tags", "items[].tags[]", "pagination", "pagination.size", "pagination.index"}, fullnames)
+	require.Equal(t, "业务提示, 描述", ls.Items[1].Title)
+	require.True(t, ls.Items[0].Required)
+	require.True(t, ls.Items[3].Required)
+	for i := 0; i < 10; i++ {
+		ls2, err := lineschema.Jsonschema2Lineschema(jsonschema)
+		require.NoError(t, err)
+		require.Equal(t, ls.UniqKey(), ls2.UniqKey())
+	}
+}
+
+func TestDecimalConstraint(t *testing.T) {
+	raw := `version=http://json-schema.org/draft-07/schema#,id=in
+fullname=price,type=number,minimum=0.01,maximum=99999999.999999999999,multipleOf=0.01
+fullname=rate,type=number,maximum=99.5`
+	ls, err := lineschema.ParseLineschema(raw)
+	require.NoError(t, err)
+	require.Equal(t, "99999999.999999999999", ls.Items[0].Maximum.String())
+
+	ls2, err := lineschema.ParseLineschema(ls.String())
+	require.NoError(t, err)
+	require.Equal(t, ls.String(), ls2.String())
+
+	jsonschema, err := ls.JsonSchema()
+	require.NoError(t, err)
+	price := gjson.GetBytes(jsonschema, "properties.price")
+	require.Equal(t, gjson.Number, price.Get("maximum").Type)
+	require.Equal(t, "99999999.999999999999", price.Get("maximum").Raw)
+	require.Equal(t, "0.01", price.Get("multipleOf").Raw)
+	require.Equal(t, "0.01", price.Get("minimum").Raw)
+
+	ls3, err := lineschema.Jsonschema2Lineschema(string(jsonschema))
+	require.NoError(t, err)
+	item, ok := ls3.Items.GetByFullName("price")
+	require.True(t, ok)
+	require.Equal(t, "99999999.999999999999", item.Maximum.String())
+	require.Equal(t, "0.01", item.MultipleOf.String())
+
+	_, err = lineschema.ParseLineschema(`fullname=rate,maximum=abc`)
+	require.Error(t, err)
+}
+
+func TestJsonSchemaDraft(t *testing.T) {
+	raw := `version=https://json-schema.org/draft/2020-12/schema,id=in
+fullname=rate,type=number,maximum=100,exclusiveMaximum,minimum=0`
+	ls, err := lineschema.ParseLineschema(raw)
+	require.NoError(t, err)
+	jsonschema, err := ls.JsonSchema()
+	require.NoError(t, err)
+	require.Equal(t, lineschema.DRAFT_2020_12.String(), gjson.GetBytes(jsonschema, "$schema").String())
+	require.Equal(t, "100", gjson.GetBytes(jsonschema, "properties.rate.exclusiveMaximum").Raw)
+	require.False(t, gjson.GetBytes(jsonschema, "properties.rate.maximum").Exists())
+	require.Equal(t, "0", gjson.GetBytes(jsonschema, "properties.rate.minimum").Raw)
+
+	jsonschema, err = ls.JsonSchema(lineschema.WithDraft(lineschema.DRAFT_07))
+	require.NoError(t, err)
+	require.Equal(t, lineschema.DRAFT_07.String(), gjson.GetBytes(jsonschema, "$schema").String())
+
+	ls2, err := lineschema.Jsonschema2Lineschema(string(jsonschema))
+	require.NoError(t, err)
+	require.Equal(t, "100", ls2.Items[0].Maximum.String())
+	require.True(t, ls2.Items[0].ExclusiveMaximum)
+
+	require.Equal(t, "$defs", lineschema.ParseDraft("https://json-schema.org/draft/2019-09/schema").DefinitionsKeyword())
+	require.Equal(t, "definitions", lineschema.ParseDraft("").DefinitionsKeyword())
+	require.Equal(t, "prefixItems", lineschema.DRAFT_2020_12.TupleItemsKeyword())
+	require.Equal(t, "dependentRequired", lineschema.DRAFT_2019_09.DependentRequiredKeyword())
+}
+
+func TestJsonSchemaDefinitions(t *testing.T) {
+	raw := `version=https://json-schema.org/draft/2020-12/schema,id=in
+fullname=requestHeader,type=Parameters,required,title=请求头
+fullname=body,type=Parameter
+fullname=Parameters,type=[]Parameter,title=参数集合
+fullname=Parameter.name,required,title=名称
+fullname=Parameter.required,type=boolean`
+	ls, err := lineschema.ParseLineschema(raw)
+	require.NoError(t, err)
+	jsonschema, err := ls.JsonSchema(lineschema.WithDefinitions())
+	require.NoError(t, err)
+	require.Equal(t, "#/$defs/Parameters", gjson.GetBytes(jsonschema, "properties.requestHeader.$ref").String())
+	require.Equal(t, "#/$defs/Parameter", gjson.GetBytes(jsonschema, "properties.body.$ref").String())
+	require.Equal(t, "array", gjson.GetBytes(jsonschema, "$defs.Parameters.type").String())
+	require.Equal(t, "#/$defs/Parameter", gjson.GetBytes(jsonschema, "$defs.Parameters.items.$ref").String())
+	require.Equal(t, `["name"]`, gjson.GetBytes(jsonschema, "$defs.Parameter.required").Raw)
+	require.Equal(t, "boolean", gjson.GetBytes(jsonschema, "$defs.Parameter.properties.required.type").String())
+
+	jsonschema07, err := ls.JsonSchema(lineschema.WithDefinitions(), lineschema.WithDraft(lineschema.DRAFT_07))
+	require.NoError(t, err)
+	require.Equal(t, "#/definitions/Parameters", gjson.GetBytes(jsonschema07, "properties.requestHeader.$ref").String())
+	require.True(t, gjson.GetBytes(jsonschema07, "definitions.Parameter").Exists())
+
+	ls2, err := lineschema.Jsonschema2Lineschema(string(jsonschema))
+	require.NoError(t, err)
+	types := itemTypes(ls2.Items)
+	require.Equal(t, map[string]string{
+		"requestHeader":      "Parameters",
+		"body":               "Parameter",
+		"Parameters":         "[]Parameter",
+		"Parameter.name":     "string",
+		"Parameter.required": "boolean",
+	}, types)
+
+	flatten, err := ls.JsonSchema()
+	require.NoError(t, err)
+	flatten2, err := ls2.JsonSchema()
+	require.NoError(t, err)
+	require.JSONEq(t, string(flatten), string(flatten2))
+}
+
+func TestJsonschema2LineschemaRef(t *testing.T) {
+	documents := map[string]string{
+		"schemas/common.json": `{"definitions":{"Address":{"type":"object","properties":{"city":{"type":"string"},"geo":{"$ref":"geo.json"}}}}}`,
+		"schemas/geo.json":    `{"type":"object","properties":{"lat":{"type":"number"},"lng":{"type":"number"}}}`,
+	}
+	loader := func(uri string) ([]byte, error) {
+		doc, ok := documents[uri]
+		if !ok {
+			return nil, fmt.Errorf("not found: %s", uri)
+		}
+		return []byte(doc), nil
+	}
+	jsonschema := `{"$schema":"http://json-schema.org/draft-07/schema#","type":"object","properties":{
+"home":{"$ref":"common.json#/definitions/Address"},
+"offices":{"type":"array","items":{"$ref":"common.json#/definitions/Address"}},
+"owner":{"$ref":"#/definitions/User"},
+"partner":{"$ref":"#/properties/owner"}},
+"definitions":{"User":{"type":"object","properties":{"name":{"type":"string"}}},"Address":{"type":"string"}}}`
+	ls, err := lineschema.Jsonschema2Lineschema(jsonschema, lineschema.WithBaseURI("schemas/order.json"), lineschema.WithRefLoader(loader))
+	require.NoError(t, err)
+	types := make([]string, 0)
+	for _, item := range ls.Items {
+		types = append(types, fmt.Sprintf("%s=%s", item.Fullname, item.Type))
+	}
+	require.Equal(t, []string{
+		"home=Address2",
+		"offices=[]Address2",
+		"owner=User",
+		"partner=Owner",
+		"User.name=string",
+		"Address=string",
+		"Address2.city=string",
+		"Address2.geo=Geo",
+		"Owner=User",
+		"Geo.lat=number",
+		"Geo.lng=number",
+	}, types)
+	flatten, err := ls.JsonSchema()
+	require.NoError(t, err)
+	require.Equal(t, "number", gjson.GetBytes(flatten, "properties.offices.items.properties.geo.properties.lat.type").String())
+	require.Equal(t, "string", gjson.GetBytes(flatten, "properties.partner.properties.name.type").String())
+
+	_, err = lineschema.Jsonschema2Lineschema(`{"properties":{"a":{"$ref":"#/definitions/Missing"}}}`)
+	require.True(t, errors.Is(err, lineschema.ERROR_REF_NOT_FOUND))
+
+	_, err = lineschema.Jsonschema2Lineschema(jsonschema, lineschema.WithBaseURI("schemas/order.json"))
+	require.True(t, errors.Is(err, lineschema.ERROR_REF_LOADER_REQUIRED))
+
+	renamed, err := lineschema.Jsonschema2Lineschema(`{"type":"object","properties":{
+"address":{"$ref":"#/definitions/address"},
+"label":{"$ref":"#/definitions/string"},
+"version":{"$ref":"#/definitions/addr.v1"}},
+"definitions":{"address":{"type":"object","properties":{"city":{"type":"string"}}},"string":{"type":"object","properties":{"x":{"type":"string"}}},"addr.v1":{"type":"object","properties":{"y":{"type":"string"}}}}}`)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"address":      "Address",
+		"label":        "String",
+		"version":      "Addr_v1",
+		"Address.city": "string",
+		"String.x":     "string",
+		"Addr_v1.y":    "string",
+	}, itemTypes(renamed.Items))
+	flatten, err = renamed.JsonSchema()
+	require.NoError(t, err)
+	require.Equal(t, "string", gjson.GetBytes(flatten, "properties.address.properties.city.type").String())
+	require.Equal(t, "string", gjson.GetBytes(flatten, "properties.label.properties.x.type").String())
+	require.Equal(t, "string", gjson.GetBytes(flatten, "properties.version.properties.y.type").String())
+}
+
+func TestJsonSchemaComposition(t *testing.T) {
+	raw := `version=http://json-schema.org/draft-07/schema#,id=in
+fullname=payment,type=Card|BankAccount,discriminator=kind,required,title=支付方式
+fullname=extras,type=[]Card|BankAccount,composition=anyOf
+fullname=owner,type=User&Audit
+fullname=Card.kind,const=card,required
+fullname=Card.cardNo,required
+fullname=BankAccount.kind,const=bank,required
+fullname=BankAccount.iban,required
+fullname=User.name
+fullname=Audit.createdAt`
+	ls, err := lineschema.ParseLineschema(raw)
+	require.NoError(t, err)
+	jsonschema, err := ls.JsonSchema()
+	require.NoError(t, err)
+	require.Equal(t, "#/definitions/Card", gjson.GetBytes(jsonschema, "properties.payment.oneOf.0.$ref").String())
+	require.Equal(t, "#/definitions/BankAccount", gjson.GetBytes(jsonschema, "properties.payment.oneOf.1.$ref").String())
+	require.Equal(t, "kind", gjson.GetBytes(jsonschema, "properties.payment.discriminator.propertyName").String())
+	require.Equal(t, "#/definitions/BankAccount", gjson.GetBytes(jsonschema, "properties.payment.discriminator.mapping.bank").String())
+	require.False(t, gjson.GetBytes(jsonschema, "properties.payment.type").Exists())
+	require.Equal(t, "array", gjson.GetBytes(jsonschema, "properties.extras.type").String())
+	require.Equal(t, "#/definitions/BankAccount", gjson.GetBytes(jsonschema, "properties.extras.items.anyOf.1.$ref").String())
+	require.Equal(t, "#/definitions/Audit", gjson.GetBytes(jsonschema, "properties.owner.allOf.1.$ref").String())
+
+	loader := gojsonschema.NewBytesLoader(jsonschema)
+	result, err := gojsonschema.Validate(loader, gojsonschema.NewStringLoader(`{"payment":{"kind":"bank","iban":"DE00"}}`))
+	require.NoError(t, err)
+	require.True(t, result.Valid())
+	result, err = gojsonschema.Validate(loader, gojsonschema.NewStringLoader(`{"payment":{"kind":"bank","cardNo":"4111"}}`))
+	require.NoError(t, err)
+	require.False(t, result.Valid())
+
+	example, err := ls.JsonExample()
+	require.NoError(t, err)
+	require.True(t, gjson.Get(example, "payment.cardNo").Exists())
+	require.False(t, gjson.Get(example, "payment.iban").Exists())
+
+	ls2, err := lineschema.Jsonschema2Lineschema(string(jsonschema))
+	require.NoError(t, err)
+	items := itemsByFullname(ls2.Items)
+	require.Equal(t, "Card|BankAccount", items["payment"].Type)
+	require.Equal(t, "kind", items["payment"].Discriminator)
+	require.Equal(t, "[]Card|BankAccount", items["extras"].Type)
+	require.Equal(t, "anyOf", items["extras"].Composition)
+	require.Equal(t, "User&Audit", items["owner"].Type)
+
+	inline, err := lineschema.Jsonschema2Lineschema(`{"properties":{"id":{"oneOf":[{"type":"string"},{"type":"integer"}]}}}`)
+	require.NoError(t, err)
+	require.Equal(t, "IdVariant1|IdVariant2", inline.Items[0].Type)
+	require.Equal(t, "IdVariant1", inline.Items[1].Fullname)
+}
+
+func TestJsonSchemaMap(t *testing.T) {
+	raw := `version=http://json-schema.org/draft-07/schema#,id=in
+fullname=headers,type=map[string]Parameter,title=请求头
+fullname=labels,type=map[string]string,keyPattern=^[a-z]+$,example=v1
+fullname=tags,type=map[string][]string
+fullname=Parameter.name,example=Content-Type
+fullname=Parameter.value,example=application/json`
+	ls, err := lineschema.ParseLineschema(raw)
+	require.NoError(t, err)
+	jsonschema, err := ls.JsonSchema()
+	require.NoError(t, err)
+	require.Equal(t, "object", gjson.GetBytes(jsonschema, "properties.headers.type").String())
+	require.Equal(t, "#/definitions/Parameter", gjson.GetBytes(jsonschema, "properties.headers.additionalProperties.$ref").String())
+	require.Equal(t, "string", gjson.GetBytes(jsonschema, `properties.labels.patternProperties.^\[a-z\]+$.type`).String())
+	require.False(t, gjson.GetBytes(jsonschema, "properties.labels.keyPattern").Exists())
+	require.Equal(t, "string", gjson.GetBytes(jsonschema, "properties.tags.additionalProperties.items.type").String())
+
+	result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(jsonschema), gojsonschema.NewStringLoader(`{"headers":{"a":{"name":"x"}},"labels":{"A1":"x"}}`))
+	require.NoError(t, err)
+	require.True(t, result.Valid()) // patternProperties 只约束匹配的键
+
+	fs, err := ls.ResolveRef()
+	require.NoError(t, err)
+	item, ok := fs.Items.GetByFullName("headers")
+	require.True(t, ok)
+	require.Equal(t, "map[string]Parameter", item.Type)
+
+	example, err := ls.JsonExample()
+	require.NoError(t, err)
+	require.Equal(t, "Content-Type", gjson.Get(example, "headers.key.name").String())
+	require.Equal(t, "v1", gjson.Get(example, "labels.key").String())
+
+	ls2, err := lineschema.Jsonschema2Lineschema(string(jsonschema))
+	require.NoError(t, err)
+	items := itemsByFullname(ls2.Items)
+	require.Equal(t, "map[string]Parameter", items["headers"].Type)
+	require.Equal(t, "map[string]string", items["labels"].Type)
+	require.Equal(t, "^[a-z]+$", items["labels"].KeyPattern)
+	require.Equal(t, "map[string][]string", items["tags"].Type)
+
+	inline, err := lineschema.Jsonschema2Lineschema(`{"properties":{"scores":{"type":"object","additionalProperties":{"type":"object","properties":{"value":{"type":"number"}}}}}}`)
+	require.NoError(t, err)
+	require.Equal(t, "map[string]ScoresValue", inline.Items[0].Type)
+	require.Equal(t, "ScoresValue.value", inline.Items[1].Fullname)
+}
+
+func TestNullable(t *testing.T) {
+	raw := `version=http://json-schema.org/draft-07/schema#,id=out
+fullname=name,nullable
+fullname=status,enum=["on","off"],enumNames=["开","关"],nullable
+fullname=owner,type=User,nullable
+fullname=payment,type=Card|Cash,nullable
+fullname=User.id,type=integer
+fullname=Card.no
+fullname=Cash.amount,type=number`
+	ls, err := lineschema.ParseLineschema(raw)
+	require.NoError(t, err)
+	require.Contains(t, ls.String(), "fullname=name,nullable")
+	jsonschema, err := ls.JsonSchema()
+	require.NoError(t, err)
+	require.JSONEq(t, `["string","null"]`, gjson.GetBytes(jsonschema, "properties.name.type").Raw)
+	require.False(t, gjson.GetBytes(jsonschema, "properties.name.nullable").Exists())
+	require.False(t, gjson.GetBytes(jsonschema, "properties.owner.nullable").Exists())
+	require.JSONEq(t, `["on","off",null]`, gjson.GetBytes(jsonschema, "properties.status.enum").Raw)
+	require.Equal(t, "#/definitions/User", gjson.GetBytes(jsonschema, "properties.owner.anyOf.0.$ref").String())
+	require.Equal(t, "null", gjson.GetBytes(jsonschema, "properties.owner.anyOf.1.type").String())
+	require.Equal(t, "null", gjson.GetBytes(jsonschema, "properties.payment.oneOf.2.type").String())
+	result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(jsonschema), gojsonschema.NewStringLoader(`{"name":null,"status":null,"owner":null,"payment":null}`))
+	require.NoError(t, err)
+	require.True(t, result.Valid(), result.Errors())
+
+	flatten, err := lineschema.ParseLineschema(`version=http://json-schema.org/draft-07/schema#,id=out
+fullname=owner,type=User,nullable
+fullname=User.id,type=int`)
+	require.NoError(t, err)
+	jsonschema, err = flatten.JsonSchema()
+	require.NoError(t, err)
+	require.JSONEq(t, `["object","null"]`, gjson.GetBytes(jsonschema, "properties.owner.type").Raw)
+	require.False(t, gjson.GetBytes(jsonschema, "properties.owner.nullable").Exists())
+	require.Equal(t, "int", gjson.GetBytes(jsonschema, "properties.owner.properties.id.type").String())
+
+	ls2, err := lineschema.Jsonschema2Lineschema(`{"properties":{"name":{"type":["string","null"]},"owner":{"anyOf":[{"$ref":"#/definitions/User"},{"type":"null"}]},"status":{"type":["string","null"],"oneOf":[{"const":"on","title":"开"},{"type":"null"}]}},"definitions":{"User":{"properties":{"id":{"type":"integer"}}}}}`)
+	require.NoError(t, err)
+	items := itemsByFullname(ls2.Items)
+	require.Equal(t, "string", items["name"].Type)
+	require.True(t, items["name"].Nullable)
+	require.Equal(t, "User", items["owner"].Type)
+	require.True(t, items["owner"].Nullable)
+	require.Equal(t, `["开"]`, items["status"].EnumNames)
+
+	inferred, err := lineschema.Json2lineSchema(`{"list":[{"a":null,"b":null,"c":null},{"a":1,"b":null,"c":{"d":"x"}}]}`)
+	require.NoError(t, err)
+	items = itemsByFullname(inferred.Items)
+	require.True(t, items["list[].a"].Nullable)
+	require.Equal(t, "1", items["list[].a"].Example)
+	require.Equal(t, "string", items["list[].b"].Type)
+	require.True(t, items["list[].b"].Nullable)
+	require.Equal(t, "object", items["list[].c"].Type)
+	require.True(t, items["list[].c"].Nullable)
+}
+
+func TestJsonSchemaTuple(t *testing.T) {
+	raw := `version=http://json-schema.org/draft-07/schema#,id=out
+fullname=point[0],type=number,title=经度,example=120.1
+fullname=point[1],type=number,title=纬度,example=30.2
+fullname=errors[][0],type=integer,title=错误码,example=1001
+fullname=errors[][1],title=错误信息,example=failed
+fullname=routes[].stops[1].name,example=B`
+	ls, err := lineschema.ParseLineschema(raw)
+	require.NoError(t, err)
+	require.Equal(t, "point.1", ls.Items[1].Path)
+	require.Equal(t, "routes.#.stops.1.name", ls.Items[4].Path)
+
+	jsonschema, err := ls.JsonSchema()
+	require.NoError(t, err)
+	require.Equal(t, "array", gjson.GetBytes(jsonschema, "properties.point.type").String())
+	require.Equal(t, "纬度", gjson.GetBytes(jsonschema, "properties.point.items.1.title").String())
+	require.Equal(t, "integer", gjson.GetBytes(jsonschema, "properties.errors.items.items.0.type").String())
+	require.Equal(t, "string", gjson.GetBytes(jsonschema, "properties.routes.items.properties.stops.items.1.properties.name.type").String())
+	result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(jsonschema), gojsonschema.NewStringLoader(`{"point":[120.1,"x"]}`))
+	require.NoError(t, err)
+	require.False(t, result.Valid())
+
+	jsonschema2020, err := ls.JsonSchema(lineschema.WithDraft(lineschema.DRAFT_2020_12))
+	require.NoError(t, err)
+	require.Equal(t, "经度", gjson.GetBytes(jsonschema2020, "properties.point.prefixItems.0.title").String())
+
+	example, err := ls.JsonExample()
+	require.NoError(t, err)
+	require.JSONEq(t, `{"point":[120.1,30.2],"errors":[[1001,"failed"]],"routes":[{"stops":[null,{"name":"B"}]}]}`, example)
+
+	transfers := ls.TransferToFormat()
+	require.Equal(t, "point.0", string(transfers[0].Src.Path))
+
+	for _, schema := range [][]byte{jsonschema, jsonschema2020} {
+		ls2, err := lineschema.Jsonschema2Lineschema(string(schema))
+		require.NoError(t, err)
+		fullnames := itemFullnames(ls2.Items)
+		require.Contains(t, fullnames, "point[1]")
+		require.Contains(t, fullnames, "errors[][0]")
+		require.Contains(t, fullnames, "routes[].stops[1].name")
+		require.NotContains(t, fullnames, "routes[].stops[0]")
+	}
+}
+
+func TestJsonSchemaConditionalRequired(t *testing.T) {
+	raw := `version=http://json-schema.org/draft-07/schema#,id=in
+fullname=needInvoice,type=boolean,title=是否开票
+fullname=invoiceTitle,requiredIf={"needInvoice":true},title=发票抬头
+fullname=taxNo,dependentRequired=needInvoice,title=税号`
+	ls, err := lineschema.ParseLineschema(raw)
+	require.NoError(t, err)
+	require.Equal(t, `{"needInvoice":true}`, ls.Items[1].RequiredIf)
+
+	jsonschema, err := ls.JsonSchema()
+	require.NoError(t, err)
+	require.Equal(t, "invoiceTitle", gjson.GetBytes(jsonschema, "allOf.0.then.required.0").String())
+	require.True(t, gjson.GetBytes(jsonschema, "allOf.0.if.properties.needInvoice.const").Bool())
+	require.Equal(t, "taxNo", gjson.GetBytes(jsonschema, "dependencies.needInvoice.0").String())
+	for data, valid := range map[string]bool{
+		`{"needInvoice":true}`:                                false,
+		`{"needInvoice":true,"invoiceTitle":"a","taxNo":"1"}`: true,
+		`{"needInvoice":false}`:                               false,
+		`{"needInvoice":false,"taxNo":"1"}`:                   true,
+		`{"invoiceTitle":"a"}`:                                true,
+	} {
+		result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(jsonschema), gojsonschema.NewStringLoader(data))
+		require.NoError(t, err)
+		require.Equal(t, valid, result.Valid(), data)
+	}
+
+	jsonschema2020, err := ls.JsonSchema(lineschema.WithDraft(lineschema.DRAFT_2020_12))
+	require.NoError(t, err)
+	require.Equal(t, "taxNo", gjson.GetBytes(jsonschema2020, "dependentRequired.needInvoice.0").String())
+
+	for _, schema := range [][]byte{jsonschema, jsonschema2020} {
+		ls2, err := lineschema.Jsonschema2Lineschema(string(schema))
+		require.NoError(t, err)
+		require.Len(t, ls2.Items, 3)
+		require.Equal(t, `{"needInvoice":true}`, ls2.Items[1].RequiredIf)
+		require.Equal(t, "needInvoice", ls2.Items[2].DependentRequired)
+		require.NotContains(t, ls2.String(), "allOf")
+	}
+}
+
+func TestJson2lineSchemaFromSamples(t *testing.T) {
+	samples := []string{
+		`{"id":1,"name":"a","price":10,"tags":["x"],"extra":null,"user":{"uid":1}}`,
+		`{"id":2,"price":9.5,"tags":[],"extra":"e","user":{"uid":2,"nick":"n"},"code":"A"}`,
+		`{"id":3,"name":"c","price":8,"tags":["y"],"user":{"uid":3},"code":1}`,
+	}
+	ls, err := lineschema.Json2lineSchemaFromSamples(samples)
+	require.NoError(t, err)
+	items := itemsByFullname(ls.Items)
+	require.Equal(t, "integer", items["id"].Type)
+	require.True(t, items["id"].Required)
+	require.False(t, items["name"].Required)
+	require.Equal(t, "number", items["price"].Type)
+	require.True(t, items["tags"].Required)
+	require.Equal(t, "array", items["tags"].Type)
+	require.Equal(t, "x", items["tags[]"].Example)
+	require.True(t, items["extra"].Nullable)
+	require.False(t, items["extra"].Required)
+	require.True(t, items["user"].Required)
+	require.True(t, items["user.uid"].Required)
+	require.False(t, items["user.nick"].Required)
+	require.Equal(t, lineschema.TYPE_ANY, items["code"].Type)
+
+	jsonschema, err := ls.JsonSchema()
+	require.NoError(t, err)
+	require.False(t, gjson.GetBytes(jsonschema, "properties.code.type").Exists())
+	validator, err := ls.Compile()
+	require.NoError(t, err)
+	for _, sample := range samples {
+		result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(jsonschema), gojsonschema.NewStringLoader(sample))
+		require.NoError(t, err)
+		require.True(t, result.Valid(), sample)
+		require.NoError(t, validator.Validate([]byte(sample)), sample)
+	}
+
+	fromLines, err := lineschema.JsonLines2lineSchema(strings.NewReader(strings.Join(samples, "\n\n")))
+	require.NoError(t, err)
+	require.Equal(t, ls.String(), fromLines.String())
+
+	_, err = lineschema.Json2lineSchemaFromSamples([]string{`{"a":`})
+	require.Error(t, err)
+
+	widened, err := lineschema.Json2lineSchema(`[{"a":1},{"a":1.5},{"b":1},{"b":"x"}]`)
+	require.NoError(t, err)
+	require.Equal(t, "number", widened.Items[0].Type)
+	require.Equal(t, lineschema.TYPE_ANY, widened.Items[1].Type)
+
+	single, err := lineschema.Json2lineSchema(`[{"p":1.0}]`)
+	require.NoError(t, err)
+	fromSamples, err := lineschema.Json2lineSchemaFromSamples([]string{`[{"p":1.0}]`})
+	require.NoError(t, err)
+	require.Equal(t, fromSamples.String(), single.String())
+	require.Equal(t, "number", single.Items[0].Type)
+
+	stringly, err := lineschema.Json2lineSchemaStringly(`[{"a":1},{"a":1.5},{"b":1},{"b":"x"}]`)
+	require.NoError(t, err)
+	require.Equal(t, "float", stringly.Items[0].Format)
+	require.Equal(t, "", stringly.Items[1].Format)
+}
+
+func TestDetectFormat(t *testing.T) {
+	cases := map[string]string{
+		"2023-11-25T22:32:16+08:00":            lineschema.FORMAT_DATE_TIME,
+		"2023-11-25":                           lineschema.FORMAT_DATE,
+		"2023-11-25 22:32:16":                  "",
+		"user@example.com":                     lineschema.FORMAT_EMAIL,
+		"8c5a3c5e-2f4b-4e8a-9c1d-3b7e6f0a1d2c": lineschema.FORMAT_UUID,
+		"https://example.com/a?b=1":            lineschema.FORMAT_URI,
+		"192.168.1.1":                          lineschema.FORMAT_IPV4,
+		"13800138000":                          lineschema.FORMAT_MOBILE,
+		"+8613800138000":                       lineschema.FORMAT_MOBILE,
+		"12800138000":                          "",
+		"hello":                                "",
+		"":                                     "",
+	}
+	for value, format := range cases {
+		require.Equal(t, format, lineschema.DetectFormat(value), value)
+	}
+
+	lineschema.RegisterFormatDetector("order-no", func(value string) bool { return strings.HasPrefix(value, "SO") })
+	defer lineschema.UnregisterFormatDetector("order-no")
+	require.Equal(t, "order-no", lineschema.DetectFormat("SO20231125"))
+
+	ls, err := lineschema.Json2lineSchema(`{"createdAt":"2023-11-25T22:32:16Z","email":"a@b.cn","orderNo":"SO1","list":[{"ip":"10.0.0.1"},{"ip":"example.com"}]}`)
+	require.NoError(t, err)
+	items := itemsByFullname(ls.Items)
+	require.Equal(t, lineschema.FORMAT_DATE_TIME, items["createdAt"].Format)
+	require.Equal(t, lineschema.FORMAT_EMAIL, items["email"].Format)
+	require.Equal(t, "order-no", items["orderNo"].Format)
+	require.Equal(t, "", items["list[].ip"].Format)
+
+	inferred, err := lineschema.Json2lineSchemaFromSamples([]string{`{"id":"8c5a3c5e-2f4b-4e8a-9c1d-3b7e6f0a1d2c","phone":"13800138000"}`, `{"id":"1b9d6bcd-bbfd-4b2d-9b5d-ab8dfbbd4bed","phone":"n/a"}`})
+	require.NoError(t, err)
+	require.Equal(t, lineschema.FORMAT_UUID, inferred.Items[0].Format)
+	require.Equal(t, "", inferred.Items[1].Format)
+}
+
+func TestJson2lineSchemaProfile(t *testing.T) {
+	samples := []string{
+		`{"status":"paid","amount":10.5,"qty":1,"name":"苹果","tags":["a"]}`,
+		`{"status":"unpaid","amount":3,"qty":20,"name":"banana","tags":[]}`,
+		`{"status":"paid","amount":99.99,"qty":7,"name":"橙","tags":["a","b","c"]}`,
+	}
+	plain, err := lineschema.Json2lineSchemaFromSamples(samples)
+	require.NoError(t, err)
+	require.NotContains(t, plain.String(), "enum")
+
+	ls, err := lineschema.Json2lineSchemaFromSamples(samples, lineschema.WithProfile(0))
+	require.NoError(t, err)
+	items := itemsByFullname(ls.Items)
+	require.Equal(t, `["paid","unpaid"]`, items["status"].Enum)
+	require.Equal(t, "3", items["amount"].Minimum.String())
+	require.Equal(t, "99.99", items["amount"].Maximum.String())
+	require.Equal(t, "", items["qty"].Enum) // 取值无重复,不推断为枚举
+	require.Equal(t, "20", items["qty"].Maximum.String())
+	require.Equal(t, 1, items["name"].MinLength)
+	require.Equal(t, 6, items["name"].MaxLength)
+	require.Equal(t, 3, items["tags"].MaxItems)
+	require.Equal(t, `["a","b","c"]`, items["tags[]"].Enum)
+
+	jsonschema, err := ls.JsonSchema()
+	require.NoError(t, err)
+	for _, sample := range samples {
+		result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(jsonschema), gojsonschema.NewStringLoader(sample))
+		require.NoError(t, err)
+		require.True(t, result.Valid(), sample)
+	}
+	result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(jsonschema), gojsonschema.NewStringLoader(`{"status":"refund","amount":1,"qty":1,"name":"x","tags":[]}`))
+	require.NoError(t, err)
+	require.False(t, result.Valid())
+
+	limited, err := lineschema.Json2lineSchemaFromSamples(samples, lineschema.WithProfile(1))
+	require.NoError(t, err)
+	require.Equal(t, "", limited.Items[0].Enum)
+}
+
+func TestJsonExampleTypes(t *testing.T) {
+	ls, err := lineschema.Json2lineSchema(`[{"id":1,"price":99999999.999999999999,"paid":true,"name":"a"}]`)
+	require.NoError(t, err)
+	example, err := ls.JsonExample()
+	require.NoError(t, err)
+	require.Equal(t, `[{"id":1,"price":99999999.999999999999,"paid":true,"name":"a"}]`, example)
+}
+
+func TestAssertBasicType(t *testing.T) {
+	data := `{"id":1,"price":1.5,"paid":true,"name":"a","remark":null}`
+	ls, err := lineschema.Json2lineSchema(data)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"id": "integer", "price": "number", "paid": "boolean", "name": "string", "remark": "string"}, itemTypes(ls.Items))
+	require.Equal(t, map[string]string{"id": "", "price": "", "paid": "", "name": "", "remark": ""}, itemFormats(ls.Items))
+	jsonschema, err := ls.JsonSchema()
+	require.NoError(t, err)
+	result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(jsonschema), gojsonschema.NewStringLoader(data))
+	require.NoError(t, err)
+	require.True(t, result.Valid(), result.Errors())
+
+	stringly, err := lineschema.Json2lineSchemaStringly(data)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"id": "string", "price": "string", "paid": "string", "name": "string", "remark": "string"}, itemTypes(stringly.Items))
+	require.Equal(t, map[string]string{"id": "int", "price": "float", "paid": "boolean", "name": "", "remark": ""}, itemFormats(stringly.Items))
+}
+
+// itemFullnames 按顺序列出属性的fullname
+func itemFullnames(items lineschema.LineschemaItems) []string {
+	fullnames := make([]string, 0, len(items))
+	for _, item := range items {
+		fullnames = append(fullnames, item.Fullname)
+	}
+	return fullnames
+}
+
+// itemTypes fullname->type
+func itemTypes(items lineschema.LineschemaItems) map[string]string {
+	types := make(map[string]string, len(items))
+	for _, item := range items {
+		types[item.Fullname] = item.Type
+	}
+	return types
+}
+
+// itemsByFullname 按fullname 索引属性
+func itemsByFullname(items lineschema.LineschemaItems) map[string]*lineschema.LineschemaItem {
+	index := make(map[string]*lineschema.LineschemaItem, len(items))
+	for _, item := range items {
+		index[item.Fullname] = item
+	}
+	return index
+}
+
+// itemFormats fullname->format
+func itemFormats(items lineschema.LineschemaItems) map[string]string {
+	formats := make(map[string]string, len(items))
+	for _, item := range items {
+		formats[item.Fullname] = item.Format
+	}
+	return formats
+}
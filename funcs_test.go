@@ -15,8 +15,8 @@ func getDefaultJson() (defaul string, err error) {
 	fullname=services[].id,format=int,required,title=主键,comment=主键,example=1
 	fullname=services[].name,required,title=项目标识,comment=项目标识,example=advertise
 	fullname=services[].title,required,title=名称,comment=名称
-	fullname=services[].createdAt,format=datetime,required,title=创建时间,comment=创建时间,example=2023-01-1200:00:00
-	fullname=services[].updatedAt,format=datetime,required,title=修改时间,comment=修改时间,example=2023-01-3000:00:00
+	fullname=services[].createdAt,format=datetime,required,title=创建时间,comment=创建时间,example=2023-01-12 00:00:00
+	fullname=services[].updatedAt,format=datetime,required,title=修改时间,comment=修改时间,example=2023-01-30 00:00:00
 	fullname=services[].servers[].name,required,title=服务标识,comment=服务标识,example=dev
 	fullname=services[].servers[].title,required,title=服务名称,comment=服务名称,example=dev
 	fullname=pagination.index,format=int,required,title=页索引,0开始,default=0,comment=页索引,0开始,example=0
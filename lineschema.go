@@ -1,6 +1,7 @@
 package lineschema
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -16,15 +17,46 @@ import (
 	"github.com/tidwall/sjson"
 )
 
+// Direction 数据流向,in 为输入(请求),out 为输出(响应)
+type Direction string
+
+const (
+	DIRECTION_IN  Direction = "in"
+	DIRECTION_OUT Direction = "out"
+)
+
 type Meta struct {
-	ID          string `json:"id"`
-	Version     string `json:"version"`
-	Type        string `json:"type"`
-	Description string `json:"description"`
+	ID          string    `json:"id"`
+	Version     string    `json:"version"`
+	Type        string    `json:"type"`
+	Description string    `json:"description"`
+	Direction   Direction `json:"direction,omitempty"`
+	Title       string    `json:"title,omitempty"`
+	// AdditionalProperties 为false 时关闭所有对象(不允许未定义的属性),可在属性上用additionalProperties=true 单独放开
+	AdditionalProperties string     `json:"additionalProperties,omitempty"`
+	LeadingComments      []string   `json:"-"` // 元数据行前的注释
+	TrailingComment      string     `json:"-"` // 元数据行尾注释
+	Extensions           Extensions `json:"-"` // x-开头的扩展属性
+	// Attrs 其它未定义的元数据属性,原样保留
+	Attrs map[string]string `json:"-"`
+}
+
+// GetDirection 获取数据流向,未设置direction 时,id 为in、out 的按id 推断
+func (m Meta) GetDirection() (direction Direction) {
+	if m.Direction != "" {
+		return m.Direction
+	}
+	switch Direction(m.ID) {
+	case DIRECTION_IN, DIRECTION_OUT:
+		return Direction(m.ID)
+	}
+	return ""
 }
+
 type Lineschema struct {
-	Meta  *Meta
-	Items LineschemaItems
+	Meta        *Meta
+	Items       LineschemaItems
+	EndComments []string // 文件末尾未关联到任何行的注释
 }
 
 func NewLineschema(id string) (lschema *Lineschema) {
@@ -149,78 +181,106 @@ func (ls *LineschemaItems) Clone() (items *LineschemaItems) {
 
 const (
 	//字段基本类型,其他类型会被认定为自定义结构体
-	Type_base_set = `,string,int,float,boolean,numeber,object,array,[]string,[]int,[]float,[]boolean,[]numeber,[]object,[]array,`
+	Type_base_set = `,string,int,integer,float,boolean,number,numeber,object,array,any,[]string,[]int,[]integer,[]float,[]boolean,[]number,[]numeber,[]object,[]array,[]any,`
+	// TYPE_ANY 不限制类型(如案例中同一属性出现多种基本类型),json schema 中不输出type
+	TYPE_ANY = "any"
 )
 
-func (ls *LineschemaItems) flattenArray() {
-	for {
-		arrayStructName := ""
-		for _, item := range *ls {
-			if !strings.HasPrefix(item.Type, "[]") {
-				continue
-			}
+// ERROR_CIRCULAR_REFERENCE 自定义类型存在循环引用(直接或间接引用自身)
+var ERROR_CIRCULAR_REFERENCE = errors.New("lineschema circular reference")
+
+// RESOLVE_REF_MAX_DEPTH 必须平铺时(如TransferToFormat、JsonExample),递归类型默认展开的层数
+const RESOLVE_REF_MAX_DEPTH = 3
 
-			_, ok := CustomDefineStruct(item.Type)
-			if !ok {
+// refResolver 将自定义类型项展开为定义的属性
+type refResolver struct {
+	definitions map[string]LineschemaItems
+	maxDepth    int // <0 时遇到循环引用返回错误,否则同一类型在路径上最多展开maxDepth 层,超过的项被丢弃
+	// example 生成案例时使用:组合类型oneOf、anyOf 只展开第一个类型,map 类型转换为以MAP_EXAMPLE_KEY 为键的子属性后展开,不保留nullable 的对象项;否则展开全部类型的属性,map 保持不变
+	example bool
+}
+
+// expand 展开自定义类型,stack 记录展开路径上的类型
+func (r refResolver) expand(items LineschemaItems, stack []string) (expanded LineschemaItems, err error) {
+	expanded = make(LineschemaItems, 0)
+	for _, item := range items {
+		if _, ok := item.MapType(); ok {
+			if !r.example {
+				expanded = append(expanded, item)
 				continue
 			}
-			// 替换数组类型
-			arrayStructName = item.Type
-			for _, item2 := range *ls {
-				if item2.Type == item.Fullname {
-					item2.Fullname = fmt.Sprintf("%s[]", item2.Fullname)
-					item2.Path = fmt.Sprintf("%s.#", item2.Path)
-					item2.Type = strings.TrimPrefix(arrayStructName, "[]")
-				}
-			}
-			ls.Remove(item) // 移除数组定义
-			break           // 修改ls后从新循环
+			item = mapExampleItem(item)
 		}
-		if arrayStructName == "" {
-			break
+		names := item.customTypeNames()
+		if _, ok := item.MapType(); ok || len(names) == 0 {
+			expanded = append(expanded, item)
+			continue
 		}
-	}
-}
-
-// flattenObject 将非简单类型项展开
-func (ls *LineschemaItems) flattenObject() {
-
-	for {
-		ok := false
-		customDefineStruct := ""
-		for _, item := range *ls {
-			customDefineStruct, ok = CustomDefineStruct(item.Type)
-			if !ok {
-				continue
+		if keyword, _, ok := item.CompositeType(); ok && keyword != COMPOSITION_ALL_OF && r.example {
+			names = names[:1]
+		}
+		variants := make(LineschemaItems, 0)
+		if item.Nullable && !r.example { // 保留对象(数组)项,以便输出可为null
+			clone := *item
+			clone.Type = "object"
+			if strings.HasPrefix(item.Type, "[]") {
+				clone.Type = "array"
 			}
-			//替换对象
-			children := ls.GetByParent(customDefineStruct)
-			//检测子类是否有递归引用情况,存在则panic报错
-			for _, item := range children { // 递归平铺子类
-				subStructName, ok := CustomDefineStruct(item.Type)
-				if !ok {
-					continue
-				}
-				if subStructName == customDefineStruct {
-					err := errors.Errorf("type name(%s) circular reference. children fullname:%s", customDefineStruct, item.Fullname)
-					panic(err)
-				}
+			clone.Composition, clone.Discriminator = "", ""
+			variants = append(variants, &clone)
+		}
+		for _, name := range names {
+			children, err := r.expandType(item, name, stack)
+			if err != nil {
+				return nil, err
 			}
-
-			refItems := ls.GetByType(item.Type)
-			for _, refItem := range refItems {
-				clone := children.Clone()
-				clone.ChangeParent(refItem.Fullname, fmt.Sprintf("%s.", item.Type))
-				ls.Add((*clone)...)
-				ls.Remove(refItem)
+			for _, child := range children {
+				if _, ok := variants.GetByFullName(child.Fullname); !ok { // 多个类型的同名属性只保留第一个
+					variants = append(variants, child)
+				}
 			}
-			ls.Remove(children...)
+		}
+		expanded = append(expanded, variants...)
+	}
+	return expanded, nil
+}
 
+// expandType 将item 按类型name 展开
+func (r refResolver) expandType(item *LineschemaItem, name string, stack []string) (children LineschemaItems, err error) {
+	definition, ok := r.definitions[name]
+	if !ok {
+		return nil, nil // 未定义的类型无法展开,与之前行为一致,直接丢弃
+	}
+	depth := 0
+	for _, typeName := range stack {
+		if typeName == name {
+			depth++
 		}
-		if customDefineStruct == "" { // 经过循环搜索后不再有自定义类型,则退出
-			break
+	}
+	if depth > 0 && r.maxDepth < 0 {
+		err = errors.WithMessagef(ERROR_CIRCULAR_REFERENCE, "type name(%s) fullname:%s", name, item.Fullname)
+		return nil, err
+	}
+	if depth >= r.maxDepth && r.maxDepth >= 0 {
+		return nil, nil
+	}
+	parent := item.Fullname
+	if strings.HasPrefix(item.Type, "[]") {
+		parent = fmt.Sprintf("%s[]", parent)
+	}
+	children = make(LineschemaItems, 0, len(definition))
+	for _, defItem := range definition {
+		clone := *defItem
+		clone.Fullname = strings.TrimLeft(fmt.Sprintf("%s.%s", parent, defItem.Fullname), ".")
+		if defItem.Fullname == "" {
+			clone.Fullname = parent // 类型别名,如 Parameters=[]Parameter
 		}
+		clone.Path = ""
+		clone.InitPath()
+		children = append(children, &clone)
 	}
+	subStack := append(append(make([]string, 0, len(stack)+1), stack...), name)
+	return r.expand(children, subStack)
 }
 
 // ChangeParent 修改Fullnamne，达到移动节点效果
@@ -238,7 +298,7 @@ func (ls *LineschemaItems) ChangeParent(newParent string, oldParent string) {
 }
 
 var jsonschemalineItemOrder = []string{
-	"fullname", "src", "dst", "type", "format", "pattern", "enum", "required", "allowEmptyValue", "title", "description", "default", "comment", "example", "deprecated", "const",
+	"fullname", "src", "dst", "type", "composition", "discriminator", "keyPattern", "format", "pattern", "enum", "enumNames", "required", "requiredIf", "dependentRequired", "allowEmptyValue", "nullable", "title", "description", "default", "comment", "example", "deprecated", "const",
 	"multipleOf", "maximum", "exclusiveMaximum", "minimum", "exclusiveMinimum", "maxLength", "minLength",
 	"maxItems",
 	"minItems",
@@ -247,10 +307,13 @@ var jsonschemalineItemOrder = []string{
 	"minContains",
 	"maxProperties",
 	"minProperties",
+	"additionalProperties",
 	"contentEncoding",
 	"contentMediaType",
 	"readOnly",
 	"writeOnly",
+	"examples",
+	"ref",
 }
 
 func (l *Lineschema) Validate() (err error) {
@@ -260,6 +323,11 @@ func (l *Lineschema) Validate() (err error) {
 	if l.Meta.ID == "" {
 		return errors.Errorf("lineschema meta.Id required")
 	}
+	switch l.Meta.Direction {
+	case "", DIRECTION_IN, DIRECTION_OUT:
+	default:
+		return errors.Errorf("lineschema meta.direction must be %s or %s, got:%s", DIRECTION_IN, DIRECTION_OUT, l.Meta.Direction)
+	}
 	return err
 }
 
@@ -269,56 +337,128 @@ func (l *Lineschema) UniqKey() (uniqKey string) {
 	return uniqKey
 }
 
-// ResolveRef  Lineschema 新增支持自定义类型，类似引用，调用此函数后，通过重复填充消除引用，在路径转换时必须先展开到基本类型
-func (l Lineschema) ResolveRef() (flatten Lineschema) {
+// ResolveRef  Lineschema 新增支持自定义类型，类似引用，调用此函数后，通过重复填充消除引用，在路径转换时必须先展开到基本类型;类型存在循环引用时返回ERROR_CIRCULAR_REFERENCE,组合类型展开为全部类型属性的并集
+func (l Lineschema) ResolveRef() (flatten Lineschema, err error) {
+	return l.resolveRef(refResolver{maxDepth: -1})
+}
+
+// ResolveRefWithDepth 同ResolveRef,递归类型最多展开maxDepth 层,更深的属性被截断,不会返回错误
+func (l Lineschema) ResolveRefWithDepth(maxDepth int) (flatten Lineschema) {
+	if maxDepth < 0 {
+		maxDepth = 0
+	}
+	flatten, _ = l.resolveRef(refResolver{maxDepth: maxDepth})
+	return flatten
+}
+
+func (l Lineschema) resolveRef(resolver refResolver) (flatten Lineschema, err error) {
 	flatten = Lineschema{
 		Meta:  l.Meta,
 		Items: make(LineschemaItems, 0),
 	}
-	items := l.Items.Clone()
-	items.flattenArray()  // 解决数组结构体定义
-	items.flattenObject() // 解决对象结构体定义
-	flatten.Items = *items
-	return flatten
+	items, definitions, _ := l.Definitions()
+	resolver.definitions = definitions
+	items, err = resolver.expand(*items.Clone(), nil)
+	if err != nil {
+		return flatten, err
+	}
+	flatten.Items = items
+	return flatten, nil
 }
 
 func (l *Lineschema) String() string {
 	lineArr := make([]string, 0)
-	lineArr = append(lineArr, fmt.Sprintf("version=%s,id=%s", l.Meta.Version, l.Meta.ID))
-	var linemap []map[string]string
+	metaArr := []string{formatPair("version", l.Meta.Version), formatPair("id", l.Meta.ID)}
+	optionalPairs := [][2]string{
+		{"type", l.Meta.Type},
+		{"direction", string(l.Meta.Direction)},
+		{"title", l.Meta.Title},
+		{"description", l.Meta.Description},
+		{"additionalProperties", l.Meta.AdditionalProperties},
+	}
+	for _, pair := range optionalPairs {
+		if pair[1] != "" {
+			metaArr = append(metaArr, formatPair(pair[0], pair[1]))
+		}
+	}
+	metaArr = append(metaArr, Extensions(l.Meta.Attrs).pairs()...)
+	metaArr = append(metaArr, l.Meta.Extensions.pairs()...)
+	metaLine := strings.Join(metaArr, ",")
+	lineArr = append(lineArr, withComments(metaLine, l.Meta.LeadingComments, l.Meta.TrailingComment)...)
+	var linemap []map[string]interface{}
 	b, err := json.Marshal(l.Items)
 	if err != nil {
 		err = errors.WithStack(err)
 		panic(err)
 	}
-	err = json.Unmarshal(b, &linemap)
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber() // 数字原样输出,不损失精度
+	err = decoder.Decode(&linemap)
 	if err != nil {
 		err = errors.WithStack(err)
 		panic(err)
 	}
 
-	for _, m := range linemap {
+	for i, m := range linemap {
 		kvArr := make([]string, 0)
 		for _, k := range jsonschemalineItemOrder {
-			v, ok := m[k]
+			value, ok := m[k]
 			if ok {
+				v := cast.ToString(value)
 				if k == "type" && v == "string" {
 					continue // 字符串类型,默认不写
 				}
 				if v == "true" {
 					kvArr = append(kvArr, k)
 				} else {
-					kvArr = append(kvArr, fmt.Sprintf("%s=%s", k, v))
+					kvArr = append(kvArr, formatPair(k, v))
 				}
 			}
 		}
+		item := l.Items[i]
+		kvArr = append(kvArr, item.Extensions.pairs()...)
 		line := strings.Join(kvArr, ",")
-		lineArr = append(lineArr, line)
+		lineArr = append(lineArr, withComments(line, item.LeadingComments, item.TrailingComment)...)
 	}
+	lineArr = append(lineArr, l.EndComments...)
 	out := strings.Join(lineArr, EOF)
 	return out
 }
 
+// Lineschemas 多个schema,对应包含多个元数据行的文件
+type Lineschemas []*Lineschema
+
+// GetByID 按Meta.ID 查找schema
+func (ls Lineschemas) GetByID(id string) (lineschema *Lineschema, ok bool) {
+	for _, l := range ls {
+		if l.Meta != nil && l.Meta.ID == id {
+			return l, true
+		}
+	}
+	return nil, false
+}
+
+// String 输出为一个文件,schema 之间以空行分隔,可通过ParseLineschemas 解析回来
+func (ls Lineschemas) String() string {
+	schemaArr := make([]string, 0, len(ls))
+	for _, l := range ls {
+		schemaArr = append(schemaArr, l.String())
+	}
+	out := strings.Join(schemaArr, EOF+EOF)
+	return out
+}
+
+// withComments 在行前增加注释行,行尾增加注释
+func withComments(line string, leadingComments []string, trailingComment string) (lines []string) {
+	lines = make([]string, 0, len(leadingComments)+1)
+	lines = append(lines, leadingComments...)
+	if trailingComment != "" {
+		line = fmt.Sprintf("%s %s", line, trailingComment)
+	}
+	lines = append(lines, line)
+	return lines
+}
+
 // BaseNames 获取所有基础名称
 func (l *Lineschema) BaseNames() (names []string) {
 	names = make([]string, 0)
@@ -328,22 +468,52 @@ func (l *Lineschema) BaseNames() (names []string) {
 	return names
 }
 
-func (l *Lineschema) JsonSchema() (jsonschemaByte []byte, err error) {
+// JsonSchema 转换成json schema,默认按Meta.Version 对应的草案版本输出,可通过WithDraft 指定
+func (l *Lineschema) JsonSchema(options ...JsonSchemaOption) (jsonschemaByte []byte, err error) {
+	option := l.newJsonSchemaOption(options...)
 	kvs := kvstruct.KVS{
-		{Key: "$schema", Value: "http://json-schema.org/draft-07/schema#"},
+		{Key: "$schema", Value: option.draft.String()},
 	}
-	lineschema := l.ResolveRef()
-	for _, item := range lineschema.Items {
-		subKvs, err := item.ToJsonSchemaKVS()
+	if l.Meta != nil {
+		if l.Meta.Title != "" {
+			kvs.Add(kvstruct.KV{Key: "title", Value: l.Meta.Title})
+		}
+		if l.Meta.Description != "" {
+			kvs.Add(kvstruct.KV{Key: "description", Value: l.Meta.Description})
+		}
+		kvs.Add(l.Meta.Extensions.ToKVS("")...)
+	}
+	if option.useDefinitions {
+		subKvs, err := l.definitionsJsonSchemaKVS(option)
 		if err != nil {
 			return nil, err
 		}
 		kvs.Add(subKvs...)
+	} else {
+		if l.Items.hasCompositeType() || l.Items.hasCustomMapType() { // 组合类型、map 值类型无法平铺,改为输出$defs,通过$ref 引用
+			return l.JsonSchema(append(options, WithDefinitions())...)
+		}
+		lineschema, err := l.ResolveRef()
+		if errors.Is(err, ERROR_CIRCULAR_REFERENCE) { // 递归类型无法平铺,改为输出$defs,通过$ref 形成引用环
+			return l.JsonSchema(append(options, WithDefinitions())...)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range lineschema.Items {
+			subKvs, err := item.toJsonSchemaKVS(option)
+			if err != nil {
+				return nil, err
+			}
+			kvs.Add(subKvs...)
+		}
 	}
 
 	jsonschemaByte = []byte("")
 	for _, kv := range kvs {
-		if gjson.GetBytes(jsonschemaByte, kv.Key).Exists() { // 已经存在的，不覆盖（防止 array、object 在其子属性说明后，导致覆盖）
+		// 可为null 的类型,需覆盖子属性生成的object、array
+		isNullableType := BaseName(kv.Key) == "type" && strings.HasPrefix(kv.Value, "[")
+		if gjson.GetBytes(jsonschemaByte, kv.Key).Exists() && !isNullableType { // 已经存在的，不覆盖（防止 array、object 在其子属性说明后，导致覆盖）
 			continue
 		}
 		if kvstruct.IsJsonStr(kv.Value) {
@@ -357,9 +527,25 @@ func (l *Lineschema) JsonSchema() (jsonschemaByte []byte, err error) {
 		value = kv.Value
 		baseKey := BaseName(kv.Key)
 		switch baseKey {
-		case "exclusiveMaximum", "exclusiveMinimum", "deprecated", "readOnly", "writeOnly", "uniqueItems":
+		case "deprecated", "readOnly", "writeOnly", "uniqueItems", "additionalProperties":
 			value = kv.Value == "true"
-		case "multipleOf", "maximum", "minimum", "maxLength", "minLength", "maxItems", "minItems", "maxContains", "minContains", "maxProperties", "minProperties":
+		case "multipleOf", "maximum", "minimum", "exclusiveMaximum", "exclusiveMinimum": // 任意精度数字,原样写入
+			if isJSONNumber(kv.Value) {
+				jsonschemaByte, err = sjson.SetRawBytes(jsonschemaByte, kv.Key, []byte(kv.Value))
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+		case "const": // attrKVS 已转换为json 文本,按类型写入
+			if gjson.Valid(kv.Value) {
+				jsonschemaByte, err = sjson.SetRawBytes(jsonschemaByte, kv.Key, []byte(kv.Value))
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+		case "maxLength", "minLength", "maxItems", "minItems", "maxContains", "minContains", "maxProperties", "minProperties":
 			value, _ = strconv.Atoi(kv.Value)
 		}
 		jsonschemaByte, err = sjson.SetBytes(jsonschemaByte, kv.Key, value)
@@ -367,12 +553,155 @@ func (l *Lineschema) JsonSchema() (jsonschemaByte []byte, err error) {
 			return nil, err
 		}
 	}
+	if l.Meta != nil && l.Meta.AdditionalProperties == "false" {
+		jsonschemaByte, err = closeObjects(jsonschemaByte, option.draft, l.Items.allOfTypeNames())
+		if err != nil {
+			return nil, err
+		}
+	}
 	return jsonschemaByte, nil
 }
 
+// Definitions 拆分出自定义类型定义,返回非定义的属性及各类型的定义属性(fullname 去掉类型名前缀,类型别名如Parameters=[]Parameter 的fullname 为空),names 按出现顺序排列
+func (l Lineschema) Definitions() (items LineschemaItems, definitions map[string]LineschemaItems, names []string) {
+	definitions = make(map[string]LineschemaItems)
+	names = make([]string, 0)
+	for _, item := range l.Items {
+		for _, name := range item.customTypeNames() {
+			if definitions[name] != nil {
+				continue
+			}
+			for _, defItem := range l.Items {
+				if defItem.Fullname != name && !strings.HasPrefix(defItem.Fullname, name+".") {
+					continue
+				}
+				clone := *defItem
+				clone.Fullname = strings.TrimPrefix(strings.TrimPrefix(defItem.Fullname, name), ".")
+				clone.Path = ""
+				clone.InitPath()
+				definitions[name] = append(definitions[name], &clone)
+			}
+			if definitions[name] != nil {
+				names = append(names, name)
+			}
+		}
+	}
+	items = make(LineschemaItems, 0)
+	for _, item := range l.Items {
+		root := strings.SplitN(item.Fullname, ".", 2)[0]
+		if definitions[root] == nil {
+			items = append(items, item)
+		}
+	}
+	return items, definitions, names
+}
+
+// definitionsJsonSchemaKVS 自定义类型输出到$defs 时的json schema kv
+func (l Lineschema) definitionsJsonSchemaKVS(option *jsonSchemaOption) (kvs kvstruct.KVS, err error) {
+	kvs = make(kvstruct.KVS, 0)
+	items, definitions, names := l.Definitions()
+	option.definitions = make(map[string]bool)
+	option.definitionItems = definitions
+	for _, name := range names {
+		option.definitions[name] = true
+	}
+	for _, item := range items {
+		subKvs, err := itemJsonSchemaKVS(item, option)
+		if err != nil {
+			return nil, err
+		}
+		kvs.Add(subKvs...)
+	}
+	for _, name := range names {
+		prefix := joinKey(option.draft.DefinitionsKeyword(), name)
+		for _, item := range definitions[name] {
+			subKvs, err := itemJsonSchemaKVS(item, option)
+			if err != nil {
+				return nil, err
+			}
+			for _, kv := range subKvs {
+				if kv.Key == "$schema" {
+					continue
+				}
+				kv.Key = joinKey(prefix, kv.Key)
+				kvs.Add(kv)
+			}
+		}
+	}
+	return kvs, nil
+}
+
+// itemJsonSchemaKVS fullname 为空时(如类型别名、根节点),属性即为根节点
+func itemJsonSchemaKVS(item *LineschemaItem, option *jsonSchemaOption) (kvs kvstruct.KVS, err error) {
+	if item.Fullname == "" {
+		return item.attrKVS("", option)
+	}
+	return item.toJsonSchemaKVS(option)
+}
+
+// JsonSchemaOption json schema 输出选项
+type JsonSchemaOption func(o *jsonSchemaOption)
+
+type jsonSchemaOption struct {
+	draft           Draft
+	useDefinitions  bool
+	definitions     map[string]bool            // 输出到$defs 的自定义类型
+	definitionItems map[string]LineschemaItems // 自定义类型的定义属性
+}
+
+// refKVS 自定义类型输出到$defs 时,生成引用该类型的kv
+func (o *jsonSchemaOption) refKVS(typ string, fullKey string) (kvs kvstruct.KVS, ok bool) {
+	name, ok := CustomDefineStruct(typ)
+	if !ok || !o.definitions[name] {
+		return nil, false
+	}
+	ref := o.ref(name)
+	if strings.HasPrefix(typ, "[]") {
+		kvs = kvstruct.KVS{
+			{Key: joinKey(fullKey, "type"), Value: "array"},
+			{Key: joinKey(fullKey, "items.$ref"), Value: ref},
+		}
+		return kvs, true
+	}
+	kvs = kvstruct.KVS{{Key: joinKey(fullKey, "$ref"), Value: ref}}
+	return kvs, true
+}
+
+// ref 自定义类型在$defs(definitions) 中的引用地址
+func (o *jsonSchemaOption) ref(name string) string {
+	return fmt.Sprintf("#/%s/%s", o.draft.DefinitionsKeyword(), name)
+}
+
+func (l *Lineschema) newJsonSchemaOption(options ...JsonSchemaOption) (o *jsonSchemaOption) {
+	o = &jsonSchemaOption{
+		draft: DRAFT_07,
+	}
+	if l.Meta != nil {
+		o.draft = ParseDraft(l.Meta.Version)
+	}
+	for _, option := range options {
+		option(o)
+	}
+	return o
+}
+
+// WithDefinitions 自定义类型不再展开,输出到$defs(draft-07 为definitions),使用处通过$ref 引用
+func WithDefinitions() JsonSchemaOption {
+	return func(o *jsonSchemaOption) {
+		o.useDefinitions = true
+	}
+}
+
+// WithDraft 指定输出的json schema 草案版本
+func WithDraft(draft Draft) JsonSchemaOption {
+	return func(o *jsonSchemaOption) {
+		o.draft = draft
+	}
+}
+
 // TransferToFormat 获取转换对象 源为type，目标为format
 func (lineschema Lineschema) TransferToFormat() (transfers pathtransfer.Transfers) {
-	resolveRef := lineschema.ResolveRef()
+	resolveRef := lineschema.ResolveRefWithDepth(RESOLVE_REF_MAX_DEPTH)
 	transfers = make(pathtransfer.Transfers, 0)
 	for _, item := range resolveRef.Items {
 
@@ -400,7 +729,7 @@ func (lineschema Lineschema) TransferToFormat() (transfers pathtransfer.Transfer
 }
 
 func (lineschema Lineschema) JsonExample() (jsonStr string, err error) {
-	resolved := lineschema.ResolveRef()
+	resolved, _ := lineschema.resolveRef(refResolver{maxDepth: RESOLVE_REF_MAX_DEPTH, example: true})
 	for _, item := range resolved.Items {
 		valueStr := item.Example
 		if valueStr == "" {
@@ -408,15 +737,33 @@ func (lineschema Lineschema) JsonExample() (jsonStr string, err error) {
 		}
 
 		setPath := strings.ReplaceAll(item.Fullname, "[]", ".0") // 生成案例时，数组只设置第一个,fullname ,基本数组类型，item.Fullname最后有[],而item.Path 没有.#
+		// 元组按位置设置
+		setPath = strings.TrimPrefix(tupleIndexRegexp.ReplaceAllString(setPath, ".$1"), ".")
+		// map 类型案例为json 对象,原样写入
+		if _, ok := item.MapType(); ok {
+			jsonStr, err = sjson.SetRaw(jsonStr, setPath, valueStr)
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
 		var value any
 		value = valueStr
+		isNumberType := false
 		switch item.Type {
-		case "int":
-			value = cast.ToInt(valueStr)
+		case "int", "integer":
+			value, isNumberType = cast.ToInt(valueStr), true
+		case "float", "number", "numeber":
+			value, isNumberType = cast.ToFloat64(valueStr), true
 		case "boolean", "bool":
 			value = cast.ToBool(valueStr)
 		}
-		jsonStr, err = sjson.Set(jsonStr, setPath, value)
+		// 数字案例原样写入,不损失精度;不限制类型时,json 格式的案例按json 写入
+		if (isNumberType && isJSONNumber(valueStr)) || (item.Type == TYPE_ANY && gjson.Valid(valueStr)) {
+			jsonStr, err = sjson.SetRaw(jsonStr, setPath, valueStr)
+		} else {
+			jsonStr, err = sjson.Set(jsonStr, setPath, value)
+		}
 		if err != nil {
 			return "", err
 		}
@@ -0,0 +1,251 @@
+package lineschema
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// closeObjects 为json schema 中未声明additionalProperties 的对象节点设置additionalProperties=false,skipDefinitions 中的定义(如allOf 引用的类型)不关闭,否则组合后无法通过校验
+func closeObjects(jsonschema []byte, draft Draft, skipDefinitions map[string]bool) (closed []byte, err error) {
+	paths := make([]string, 0)
+	root := gjson.ParseBytes(jsonschema)
+	collectObjectPaths(root, "", &paths)
+	root.Get(draft.DefinitionsKeyword()).ForEach(func(key, schema gjson.Result) bool {
+		if !skipDefinitions[key.String()] {
+			collectObjectPaths(schema, joinKey(draft.DefinitionsKeyword(), gjsonPathEscaper.Replace(key.String())), &paths)
+		}
+		return true
+	})
+	closed = jsonschema
+	for _, path := range paths {
+		closed, err = sjson.SetBytes(closed, joinKey(path, "additionalProperties"), false)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return closed, nil
+}
+
+// collectObjectPaths 收集需要关闭的对象节点路径,map(additionalProperties 为schema)、引用节点不处理
+func collectObjectPaths(schema gjson.Result, path string, paths *[]string) {
+	if !schema.IsObject() {
+		return
+	}
+	isObject := schema.Get("type").String() == "object" || schema.Get("properties").Exists()
+	if isObject && !schema.Get("additionalProperties").Exists() && !schema.Get("patternProperties").Exists() {
+		*paths = append(*paths, path)
+	}
+	schema.Get("properties").ForEach(func(key, property gjson.Result) bool {
+		collectObjectPaths(property, joinKey(path, "properties."+gjsonPathEscaper.Replace(key.String())), paths)
+		return true
+	})
+	for _, keyword := range []string{"items", DRAFT_2020_12.TupleItemsKeyword()} {
+		items := schema.Get(keyword)
+		if !items.IsArray() {
+			collectObjectPaths(items, joinKey(path, keyword), paths)
+			continue
+		}
+		for i, item := range items.Array() { // 元组
+			collectObjectPaths(item, joinKey(path, fmt.Sprintf("%s.%d", keyword, i)), paths)
+		}
+	}
+	collectObjectPaths(schema.Get("additionalProperties"), joinKey(path, "additionalProperties"), paths)
+	schema.Get("patternProperties").ForEach(func(key, property gjson.Result) bool {
+		collectObjectPaths(property, joinKey(path, "patternProperties."+gjsonPathEscaper.Replace(key.String())), paths)
+		return true
+	})
+}
+
+// allOfTypeNames allOf 组合类型引用的自定义类型
+func (ls LineschemaItems) allOfTypeNames() (names map[string]bool) {
+	names = make(map[string]bool)
+	for _, item := range ls {
+		if keyword, typeNames, ok := item.CompositeType(); ok && keyword == COMPOSITION_ALL_OF {
+			for _, name := range typeNames {
+				names[name] = true
+			}
+		}
+	}
+	return names
+}
+
+// fieldNode 描述json 中允许出现的字段,用于裁剪未定义的字段
+type fieldNode struct {
+	open       bool // additionalProperties=true,不裁剪
+	properties map[string]*fieldNode
+	items      *fieldNode
+	mapValue   *fieldNode
+	variants   []*fieldNode // 引用的自定义类型(组合类型有多个)
+}
+
+func newFieldNode() *fieldNode {
+	return &fieldNode{properties: make(map[string]*fieldNode)}
+}
+
+// fieldView 合并节点及其引用类型后的视图
+type fieldView struct {
+	open       bool
+	properties map[string][]*fieldNode
+	items      []*fieldNode
+	mapValues  []*fieldNode
+}
+
+func (n *fieldNode) view() (view *fieldView) {
+	view = &fieldView{properties: make(map[string][]*fieldNode)}
+	visited := make(map[*fieldNode]bool)
+	var collect func(node *fieldNode)
+	collect = func(node *fieldNode) {
+		if node == nil || visited[node] {
+			return
+		}
+		visited[node] = true
+		view.open = view.open || node.open
+		for name, property := range node.properties {
+			view.properties[name] = append(view.properties[name], property)
+		}
+		if node.items != nil {
+			view.items = append(view.items, node.items)
+		}
+		if node.mapValue != nil {
+			view.mapValues = append(view.mapValues, node.mapValue)
+		}
+		for _, variant := range node.variants {
+			collect(variant)
+		}
+	}
+	collect(n)
+	return view
+}
+
+// fieldTree 根据lineschema 构造字段树,自定义类型共享同一节点,支持递归类型
+type fieldTree struct {
+	definitions map[string]LineschemaItems
+	types       map[string]*fieldNode
+}
+
+func (t *fieldTree) typeNode(name string) (node *fieldNode) {
+	if node, ok := t.types[name]; ok {
+		return node
+	}
+	node = newFieldNode()
+	t.types[name] = node
+	t.fill(node, t.definitions[name])
+	return node
+}
+
+// fill 将属性添加到根节点root 下
+func (t *fieldTree) fill(root *fieldNode, items LineschemaItems) {
+	for _, item := range items {
+		node := root
+		fullname := strings.Trim(item.Fullname, ".")
+		if fullname != "" {
+			for _, segment := range strings.Split(fullname, ".") {
+				name, suffixes := splitArraySuffix(segment)
+				if name != "" {
+					child, ok := node.properties[name]
+					if !ok {
+						child = newFieldNode()
+						node.properties[name] = child
+					}
+					node = child
+				}
+				for range suffixes { // 元组各位置的元素合并为同一节点
+					if node.items == nil {
+						node.items = newFieldNode()
+					}
+					node = node.items
+				}
+			}
+		}
+		t.apply(node, item)
+	}
+}
+
+// apply 根据属性类型设置节点
+func (t *fieldTree) apply(node *fieldNode, item *LineschemaItem) {
+	if item.AdditionalProperties == "true" {
+		node.open = true
+	}
+	typ := item.Type
+	if valueType, ok := item.MapType(); ok {
+		node.mapValue = newFieldNode()
+		valueItem := *item
+		valueItem.Type = valueType
+		valueItem.AdditionalProperties = ""
+		t.apply(node.mapValue, &valueItem)
+		return
+	}
+	for strings.HasPrefix(typ, "[]") {
+		typ = strings.TrimPrefix(typ, "[]")
+		if node.items == nil {
+			node.items = newFieldNode()
+		}
+		node = node.items
+	}
+	for _, name := range item.customTypeNames() {
+		node.variants = append(node.variants, t.typeNode(name))
+	}
+}
+
+// StripUnknownFields 按lineschema 裁剪json 中未定义的字段(包括自定义类型、map 值中的字段),additionalProperties=true 的对象及未定义子属性的对象原样保留
+func (l Lineschema) StripUnknownFields(data []byte) (stripped []byte, err error) {
+	if !gjson.ValidBytes(data) {
+		err = errors.Errorf("invalid json: %s", string(data))
+		return nil, err
+	}
+	items, definitions, _ := l.Definitions()
+	tree := &fieldTree{definitions: definitions, types: make(map[string]*fieldNode)}
+	root := newFieldNode()
+	tree.fill(root, items)
+	var w bytes.Buffer
+	stripFields(&w, gjson.ParseBytes(data), root)
+	return w.Bytes(), nil
+}
+
+func stripFields(w *bytes.Buffer, value gjson.Result, node *fieldNode) {
+	view := node.view()
+	hasStructure := len(view.properties) > 0 || len(view.items) > 0 || len(view.mapValues) > 0
+	switch {
+	case view.open || !hasStructure:
+		w.WriteString(value.Raw)
+	case value.IsObject():
+		w.WriteByte('{')
+		first := true
+		value.ForEach(func(key, v gjson.Result) bool {
+			var child *fieldNode
+			if candidates := view.properties[key.String()]; len(candidates) > 0 {
+				child = &fieldNode{variants: candidates}
+			} else if len(view.mapValues) > 0 {
+				child = &fieldNode{variants: view.mapValues}
+			} else {
+				return true
+			}
+			if !first {
+				w.WriteByte(',')
+			}
+			first = false
+			w.WriteString(key.Raw)
+			w.WriteByte(':')
+			stripFields(w, v, child)
+			return true
+		})
+		w.WriteByte('}')
+	case value.IsArray() && len(view.items) > 0:
+		w.WriteByte('[')
+		child := &fieldNode{variants: view.items}
+		for i, element := range value.Array() {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			stripFields(w, element, child)
+		}
+		w.WriteByte(']')
+	default:
+		w.WriteString(value.Raw)
+	}
+}
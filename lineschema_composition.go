@@ -0,0 +1,101 @@
+package lineschema
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/suifengpiao14/kvstruct"
+)
+
+const (
+	COMPOSITION_ONE_OF = "oneOf" // 类型名用 | 连接,如 Card|BankAccount
+	COMPOSITION_ANY_OF = "anyOf" // 类型名用 | 连接,且 composition=anyOf
+	COMPOSITION_ALL_OF = "allOf" // 类型名用 & 连接,如 Base&Extra
+
+	TOKEN_ONE_OF = "|"
+	TOKEN_ALL_OF = "&"
+)
+
+// CompositeType 解析组合类型,如 Card|BankAccount、[]Card|BankAccount、Base&Extra,返回组合关键字及各自定义类型名;| 与 & 不支持混用
+func (jItem LineschemaItem) CompositeType() (keyword string, typeNames []string, ok bool) {
+	if _, isMap := jItem.MapType(); isMap {
+		return "", nil, false
+	}
+	typ := strings.TrimPrefix(jItem.Type, "[]")
+	switch {
+	case strings.Contains(typ, TOKEN_ONE_OF):
+		keyword = COMPOSITION_ONE_OF
+		if jItem.Composition == COMPOSITION_ANY_OF {
+			keyword = COMPOSITION_ANY_OF
+		}
+		typeNames = strings.Split(typ, TOKEN_ONE_OF)
+	case strings.Contains(typ, TOKEN_ALL_OF):
+		keyword = COMPOSITION_ALL_OF
+		typeNames = strings.Split(typ, TOKEN_ALL_OF)
+	default:
+		return "", nil, false
+	}
+	for i := range typeNames {
+		typeNames[i] = strings.TrimSpace(typeNames[i])
+	}
+	return keyword, typeNames, true
+}
+
+// customTypeNames 属性引用的自定义类型名,组合类型返回其包含的全部类型
+func (jItem LineschemaItem) customTypeNames() (names []string) {
+	if _, typeNames, ok := jItem.CompositeType(); ok {
+		return typeNames
+	}
+	typ := jItem.Type
+	if valueType, ok := jItem.MapType(); ok {
+		typ = valueType
+	}
+	if name, ok := CustomDefineStruct(typ); ok {
+		return []string{name}
+	}
+	return nil
+}
+
+// hasCompositeType 是否存在组合类型,组合类型无法平铺,json schema 需通过$defs 引用
+func (ls LineschemaItems) hasCompositeType() bool {
+	for _, item := range ls {
+		if _, _, ok := item.CompositeType(); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// compositeKVS 组合类型输出为 oneOf/anyOf/allOf 引用列表,oneOf、anyOf 有discriminator 时,根据各类型中discriminator 属性的const 生成mapping
+func (o *jsonSchemaOption) compositeKVS(jItem LineschemaItem, fullKey string) (kvs kvstruct.KVS, ok bool) {
+	keyword, typeNames, ok := jItem.CompositeType()
+	if !ok {
+		return nil, false
+	}
+	for _, name := range typeNames {
+		if !o.definitions[name] {
+			return nil, false
+		}
+	}
+	kvs = make(kvstruct.KVS, 0)
+	if strings.HasPrefix(jItem.Type, "[]") {
+		kvs.Add(kvstruct.KV{Key: joinKey(fullKey, "type"), Value: "array"})
+		fullKey = joinKey(fullKey, "items")
+	}
+	for i, name := range typeNames {
+		kvs.Add(kvstruct.KV{Key: joinKey(fullKey, fmt.Sprintf("%s.%d.$ref", keyword, i)), Value: o.ref(name)})
+	}
+	if jItem.Discriminator == "" || keyword == COMPOSITION_ALL_OF {
+		return kvs, true
+	}
+	kvs.Add(kvstruct.KV{Key: joinKey(fullKey, "discriminator.propertyName"), Value: jItem.Discriminator})
+	for _, name := range typeNames {
+		for _, defItem := range o.definitionItems[name] {
+			if defItem.Fullname == jItem.Discriminator && defItem.Const != "" {
+				mappingKey := joinKey(fullKey, fmt.Sprintf("discriminator.mapping.%s", gjsonPathEscaper.Replace(defItem.Const)))
+				kvs.Add(kvstruct.KV{Key: mappingKey, Value: o.ref(name)})
+			}
+		}
+	}
+	return kvs, true
+}
@@ -0,0 +1,74 @@
+package lineschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/suifengpiao14/kvstruct"
+)
+
+// requiredIfCondition 解析requiredIf,如 {"needInvoice":true} 表示同级属性needInvoice 为true 时必填
+func (jItem LineschemaItem) requiredIfCondition() (condition map[string]interface{}, err error) {
+	decoder := json.NewDecoder(strings.NewReader(jItem.RequiredIf))
+	decoder.UseNumber()
+	err = decoder.Decode(&condition)
+	if err != nil {
+		err = errors.WithMessagef(err, "invalid requiredIf: %s, fullname:%s", jItem.RequiredIf, jItem.Fullname)
+		return nil, err
+	}
+	return condition, nil
+}
+
+// dependentFields 解析dependentRequired,可为单个属性名或json 数组,表示这些同级属性存在时必填
+func (jItem LineschemaItem) dependentFields() (fields []string, err error) {
+	if !strings.HasPrefix(jItem.DependentRequired, "[") {
+		return []string{jItem.DependentRequired}, nil
+	}
+	err = json.Unmarshal([]byte(jItem.DependentRequired), &fields)
+	if err != nil {
+		err = errors.WithMessagef(err, "invalid dependentRequired: %s, fullname:%s", jItem.DependentRequired, jItem.Fullname)
+		return nil, err
+	}
+	return fields, nil
+}
+
+// conditionKVS 条件必填,输出到父对象parentKey:requiredIf 输出为allOf 中的if/then,dependentRequired 输出为dependencies(2019-09 起为dependentRequired)
+func (jItem LineschemaItem) conditionKVS(parentKey string, name string, draft Draft) (kvs kvstruct.KVS, err error) {
+	kvs = make(kvstruct.KVS, 0)
+	if jItem.RequiredIf != "" {
+		condition, err := jItem.requiredIfCondition()
+		if err != nil {
+			return nil, err
+		}
+		properties := make(map[string]interface{})
+		required := make([]string, 0, len(condition))
+		for field, value := range condition {
+			properties[field] = map[string]interface{}{"const": value}
+			required = append(required, field)
+		}
+		sort.Strings(required)
+		ifThen := map[string]interface{}{
+			"if":   map[string]interface{}{"properties": properties, "required": required},
+			"then": map[string]interface{}{"required": []string{name}},
+		}
+		b, err := json.Marshal(ifThen)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		kvs.Add(kvstruct.KV{Key: joinKey(parentKey, "allOf.-1"), Value: string(b)})
+	}
+	if jItem.DependentRequired != "" {
+		fields, err := jItem.dependentFields()
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range fields {
+			key := joinKey(parentKey, fmt.Sprintf("%s.%s.-1", draft.DependentRequiredKeyword(), gjsonPathEscaper.Replace(field)))
+			kvs.Add(kvstruct.KV{Key: key, Value: name})
+		}
+	}
+	return kvs, nil
+}
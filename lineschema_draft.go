@@ -0,0 +1,87 @@
+package lineschema
+
+import (
+	"strings"
+
+	"github.com/suifengpiao14/kvstruct"
+)
+
+// Draft json schema 草案版本,值为对应的$schema
+type Draft string
+
+const (
+	DRAFT_07      = Draft("http://json-schema.org/draft-07/schema#")
+	DRAFT_2019_09 = Draft("https://json-schema.org/draft/2019-09/schema")
+	DRAFT_2020_12 = Draft("https://json-schema.org/draft/2020-12/schema")
+)
+
+// ParseDraft 根据$schema(Meta.Version) 识别草案版本,无法识别时默认draft-07
+func ParseDraft(version string) (draft Draft) {
+	switch {
+	case strings.Contains(version, "2020-12"):
+		return DRAFT_2020_12
+	case strings.Contains(version, "2019-09"):
+		return DRAFT_2019_09
+	}
+	return DRAFT_07
+}
+
+func (d Draft) String() string {
+	return string(d)
+}
+
+// DefinitionsKeyword 自定义类型定义所在的关键字,2019-09 起为$defs
+func (d Draft) DefinitionsKeyword() string {
+	if d == DRAFT_07 {
+		return "definitions"
+	}
+	return "$defs"
+}
+
+// TupleItemsKeyword 元组按位置定义元素的关键字,2020-12 起为prefixItems
+func (d Draft) TupleItemsKeyword() string {
+	if d == DRAFT_2020_12 {
+		return "prefixItems"
+	}
+	return "items"
+}
+
+// DependentRequiredKeyword 依赖必填的关键字,2019-09 起为dependentRequired
+func (d Draft) DependentRequiredKeyword() string {
+	if d == DRAFT_07 {
+		return "dependencies"
+	}
+	return "dependentRequired"
+}
+
+// exclusiveRangeKVS 将布尔形式的exclusiveMaximum/exclusiveMinimum 转换为数字形式(draft-06 起的写法),namespace 为属性所在路径
+func exclusiveRangeKVS(kvs kvstruct.KVS, namespace string) (newKvs kvstruct.KVS) {
+	pairs := [][2]string{{"maximum", "exclusiveMaximum"}, {"minimum", "exclusiveMinimum"}}
+	newKvs = kvs
+	for _, pair := range pairs {
+		boundKey, exclusiveKey := joinKey(namespace, pair[0]), joinKey(namespace, pair[1])
+		exclusiveKv, exclusiveIndex := newKvs.GetFirstByKey(exclusiveKey)
+		if exclusiveIndex < 0 {
+			continue
+		}
+		boundKv, boundIndex := newKvs.GetFirstByKey(boundKey)
+		tmp := make(kvstruct.KVS, 0, len(newKvs))
+		for i, kv := range newKvs {
+			if i == exclusiveIndex || i == boundIndex {
+				continue
+			}
+			tmp = append(tmp, kv)
+		}
+		if exclusiveKv.Value == "true" && boundIndex > -1 {
+			tmp = append(tmp, kvstruct.KV{Key: exclusiveKey, Value: boundKv.Value})
+		} else if boundIndex > -1 {
+			tmp = append(tmp, boundKv)
+		}
+		newKvs = tmp
+	}
+	return newKvs
+}
+
+func joinKey(namespace string, key string) string {
+	return strings.Trim(namespace+"."+key, ".")
+}
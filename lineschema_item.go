@@ -10,31 +10,38 @@ import (
 )
 
 type LineschemaItem struct {
-	Path        string `json:"path"` // 此处的path 结尾的.# 代表数组元素,非gjson 的取数组长度,在转换时要注意转换
-	Type        string `json:"type"`
-	Format      string `json:"format,omitempty"`
-	Description string `json:"description,omitempty"`
-
-	Comments         string `json:"comment,omitempty"`                 // section 8.3
-	Enum             string `json:"enum,omitempty"`                    // section 6.1.2
-	EnumNames        string `json:"enumNames,omitempty"`               // section 6.1.2
-	Const            string `json:"const,omitempty"`                   // section 6.1.3
-	MultipleOf       int    `json:"multipleOf,omitempty,string"`       // section 6.2.1
-	Maximum          int    `json:"maximum,omitempty,string"`          // section 6.2.2
-	ExclusiveMaximum bool   `json:"exclusiveMaximum,omitempty,string"` // section 6.2.3
-	Minimum          int    `json:"minimum,omitempty,string"`          // section 6.2.4
-	ExclusiveMinimum bool   `json:"exclusiveMinimum,omitempty,string"` // section 6.2.5
-	MaxLength        int    `json:"maxLength,omitempty,string"`        // section 6.3.1
-	MinLength        int    `json:"minLength,omitempty,string"`        // section 6.3.2
-	Pattern          string `json:"pattern,omitempty"`                 // section 6.3.3
-	MaxItems         int    `json:"maxItems,omitempty,string"`         // section 6.4.1
-	MinItems         int    `json:"minItems,omitempty,string"`         // section 6.4.2
-	UniqueItems      bool   `json:"uniqueItems,omitempty,string"`      // section 6.4.3
-	MaxContains      uint   `json:"maxContains,omitempty,string"`      // section 6.4.4
-	MinContains      uint   `json:"minContains,omitempty,string"`      // section 6.4.5
-	MaxProperties    int    `json:"maxProperties,omitempty,string"`    // section 6.5.1
-	MinProperties    int    `json:"minProperties,omitempty,string"`    // section 6.5.2
-	Required         bool   `json:"required,omitempty,string"`         // section 6.5.3
+	Path          string `json:"path"` // 此处的path 结尾的.# 代表数组元素,非gjson 的取数组长度,在转换时要注意转换
+	Type          string `json:"type"`
+	Composition   string `json:"composition,omitempty"`     // 类型为 A|B 时,取anyOf 表示anyOf,默认oneOf
+	Discriminator string `json:"discriminator,omitempty"`   // 组合类型中用于区分具体类型的属性名
+	KeyPattern    string `json:"keyPattern,omitempty"`      // map 类型键名需匹配的正则,输出为patternProperties
+	Nullable      bool   `json:"nullable,omitempty,string"` // 可为null,输出为 type:["string","null"]
+	Format        string `json:"format,omitempty"`
+	Description   string `json:"description,omitempty"`
+
+	Comments             string      `json:"comment,omitempty"`                 // section 8.3
+	Enum                 string      `json:"enum,omitempty"`                    // section 6.1.2
+	EnumNames            string      `json:"enumNames,omitempty"`               // section 6.1.2
+	Const                string      `json:"const,omitempty"`                   // section 6.1.3
+	MultipleOf           json.Number `json:"multipleOf,omitempty"`              // section 6.2.1 任意精度数字,如0.01
+	Maximum              json.Number `json:"maximum,omitempty"`                 // section 6.2.2 任意精度数字
+	ExclusiveMaximum     bool        `json:"exclusiveMaximum,omitempty,string"` // section 6.2.3
+	Minimum              json.Number `json:"minimum,omitempty"`                 // section 6.2.4 任意精度数字
+	ExclusiveMinimum     bool        `json:"exclusiveMinimum,omitempty,string"` // section 6.2.5
+	MaxLength            int         `json:"maxLength,omitempty,string"`        // section 6.3.1
+	MinLength            int         `json:"minLength,omitempty,string"`        // section 6.3.2
+	Pattern              string      `json:"pattern,omitempty"`                 // section 6.3.3
+	MaxItems             int         `json:"maxItems,omitempty,string"`         // section 6.4.1
+	MinItems             int         `json:"minItems,omitempty,string"`         // section 6.4.2
+	UniqueItems          bool        `json:"uniqueItems,omitempty,string"`      // section 6.4.3
+	MaxContains          uint        `json:"maxContains,omitempty,string"`      // section 6.4.4
+	MinContains          uint        `json:"minContains,omitempty,string"`      // section 6.4.5
+	MaxProperties        int         `json:"maxProperties,omitempty,string"`    // section 6.5.1
+	MinProperties        int         `json:"minProperties,omitempty,string"`    // section 6.5.2
+	Required             bool        `json:"required,omitempty,string"`         // section 6.5.3
+	RequiredIf           string      `json:"requiredIf,omitempty"`              // 条件必填,如 {"needInvoice":true},输出为父对象的if/then
+	DependentRequired    string      `json:"dependentRequired,omitempty"`       // 依赖必填,同级属性(单个或json 数组)存在时必填
+	AdditionalProperties string      `json:"additionalProperties,omitempty"`    // 对象是否允许未定义的属性,false 关闭对象,true 时覆盖Meta 中的设置
 
 	// RFC draft-bhutton-json-schema-validation-00, section 8
 	ContentEncoding  string      `json:"contentEncoding,omitempty"`   // section 8.3
@@ -50,6 +57,9 @@ type LineschemaItem struct {
 	Fullname         string      `json:"fullname,omitempty"`
 	AllowEmptyValue  bool        `json:"allowEmptyValue,omitempty,string"`
 	Lineschema       *Lineschema `json:"-"`
+	LeadingComments  []string    `json:"-"` // 属性行前的注释
+	TrailingComment  string      `json:"-"` // 属性行尾注释
+	Extensions       Extensions  `json:"-"` // x-开头的扩展属性
 }
 
 func (jItem LineschemaItem) String() (jsonStr string) {
@@ -69,6 +79,7 @@ func (jItem *LineschemaItem) InitPath() {
 
 	pathArrPlaceHold := ".#"
 	jItem.Path = strings.ReplaceAll(jItem.Fullname, "[]", pathArrPlaceHold)
+	jItem.Path = tupleIndexRegexp.ReplaceAllString(jItem.Path, ".$1") // 元组元素 point[0] 路径为 point.0
 
 	//因为路径最后为# 则表示取数组长度,显然不能表达出数组的意思,2024-01-13 注释的场景: [{"Enums":[]}] 转 jsonschema后,修改路径,再转json 结果`[{"Enums":0}]`,理论上看之前应该有bug,或者无效
 	/*
@@ -87,6 +98,13 @@ func (jItem *LineschemaItem) InitPath() {
 func (jItem LineschemaItem) ToKVS(namespance string) (kvs kvstruct.KVS) {
 	jsonStr := jItem.String()
 	kvs = kvstruct.JsonToKVS(jsonStr, namespance)
+	numbers := map[string]json.Number{"multipleOf": jItem.MultipleOf, "maximum": jItem.Maximum, "minimum": jItem.Minimum}
+	for i, kv := range kvs {
+		if number, ok := numbers[BaseName(kv.Key)]; ok { // JsonToKVS 按float64 取值会损失精度,使用原始文本
+			kvs[i].Value = number.String()
+		}
+	}
+	kvs.Add(jItem.Extensions.ToKVS(namespance)...)
 	return kvs
 }
 func (jItem LineschemaItem) enum2Array() (enum []interface{}, enumNames []interface{}, err error) {
@@ -105,7 +123,16 @@ func (jItem LineschemaItem) enum2Array() (enum []interface{}, enumNames []interf
 	return enum, enumNames, nil
 }
 
+// ToJsonSchemaKVS 转换成json schema kv,草案版本取自所属Lineschema 的Meta.Version
 func (jItem LineschemaItem) ToJsonSchemaKVS() (kvs kvstruct.KVS, err error) {
+	draft := DRAFT_07
+	if jItem.Lineschema != nil && jItem.Lineschema.Meta != nil {
+		draft = ParseDraft(jItem.Lineschema.Meta.Version)
+	}
+	return jItem.toJsonSchemaKVS(&jsonSchemaOption{draft: draft})
+}
+
+func (jItem LineschemaItem) toJsonSchemaKVS(option *jsonSchemaOption) (kvs kvstruct.KVS, err error) {
 	kvs = make(kvstruct.KVS, 0)
 	arrSuffix := "[]"
 	fullname := strings.Trim(jItem.Fullname, ".")
@@ -115,37 +142,41 @@ func (jItem LineschemaItem) ToJsonSchemaKVS() (kvs kvstruct.KVS, err error) {
 	arr := strings.Split(fullname, ".")
 	kv := kvstruct.KV{
 		Key:   `$schema`,
-		Value: `http://json-schema.org/draft-07/schema#`,
+		Value: option.draft.String(),
 	}
 	kvs = append(kvs, kv)
 	prefix := ""
 	l := len(arr)
 	for i := 0; i < l; i++ {
-		key := arr[i]
-		//处理数组
-		if strings.HasSuffix(key, arrSuffix) {
-			key = strings.TrimSuffix(key, arrSuffix)
+		key, suffixes := splitArraySuffix(arr[i])
+		//处理数组,[] 为数组元素,[N] 为元组第N 个元素
+		if len(suffixes) > 0 {
 			prefix = strings.Trim(fmt.Sprintf("%s.%s", prefix, key), ".")
-			kv := kvstruct.KV{
-				Key:   strings.Trim(fmt.Sprintf("%s.type", prefix), "."),
-				Value: "array",
+			for _, suffix := range suffixes {
+				kv := kvstruct.KV{
+					Key:   strings.Trim(fmt.Sprintf("%s.type", prefix), "."),
+					Value: "array",
+				}
+				kvs = append(kvs, kv)
+				itemsKey := "items"
+				if index, ok := tupleIndex(suffix); ok {
+					itemsKey = fmt.Sprintf("%s.%d", option.draft.TupleItemsKeyword(), index)
+					for j := 0; j < index; j++ { // 前面未定义的位置不限制,避免生成null
+						kvs = append(kvs, kvstruct.KV{Key: joinKey(prefix, fmt.Sprintf("%s.%d", option.draft.TupleItemsKeyword(), j)), Value: "{}"})
+					}
+				}
+				prefix = strings.Trim(fmt.Sprintf("%s.%s", prefix, itemsKey), ".")
 			}
-			kvs = append(kvs, kv)
 			if i == l-1 {
-				fullKey := strings.Trim(fmt.Sprintf("%s.items", prefix), ".")
-				attrKvs := jItem.ToKVS(fullKey)
-				kvs.AddReplace(attrKvs...)
-				enum, enumNames, err := jItem.enum2Array()
+				attrKvs, err := jItem.attrKVS(prefix, option)
 				if err != nil {
 					return nil, err
 				}
-				subKvs := enumNames2KVS(enum, enumNames, fullKey)
-				kvs.AddReplace(subKvs...)
+				kvs.AddReplace(attrKvs...)
 				continue
 			}
-			prefix = fmt.Sprintf("%s.items", prefix)
-			kv = kvstruct.KV{
-				Key:   strings.Trim(fmt.Sprintf("%s.type", prefix), "."),
+			kv := kvstruct.KV{
+				Key:   fmt.Sprintf("%s.type", prefix),
 				Value: "object",
 			}
 			kvs = append(kvs, kv)
@@ -155,23 +186,25 @@ func (jItem LineschemaItem) ToJsonSchemaKVS() (kvs kvstruct.KVS, err error) {
 
 		//处理对象
 		if i == l-1 {
+			parentKey := strings.TrimSuffix(prefix, ".properties")
 			if jItem.Required {
-				parentKey := strings.TrimSuffix(prefix, ".properties")
 				kv := kvstruct.KV{
 					Key:   strings.Trim(fmt.Sprintf("%s.required.-1", parentKey), "."),
 					Value: key,
 				}
 				kvs.AddReplace(kv)
 			}
+			conditionKvs, err := jItem.conditionKVS(strings.Trim(parentKey, "."), key, option.draft)
+			if err != nil {
+				return nil, err
+			}
+			kvs.Add(conditionKvs...)
 			fullKey := strings.Trim(fmt.Sprintf("%s.%s", prefix, key), ".")
-			attrKvs := jItem.ToKVS(fullKey)
-			kvs.AddReplace(attrKvs...)
-			enum, enumNames, err := jItem.enum2Array()
+			attrKvs, err := jItem.attrKVS(fullKey, option)
 			if err != nil {
 				return nil, err
 			}
-			subKvs := enumNames2KVS(enum, enumNames, fullKey)
-			kvs.AddReplace(subKvs...)
+			kvs.AddReplace(attrKvs...)
 			continue
 		}
 
@@ -186,6 +219,118 @@ func (jItem LineschemaItem) ToJsonSchemaKVS() (kvs kvstruct.KVS, err error) {
 	return kvs, nil
 }
 
+// attrKVS 属性自身的json schema kv,fullKey 为属性在json schema 中的路径;自定义类型按选项输出为$ref
+func (jItem LineschemaItem) attrKVS(fullKey string, option *jsonSchemaOption) (kvs kvstruct.KVS, err error) {
+	kvs = exclusiveRangeKVS(jItem.ToKVS(fullKey), fullKey)
+	enum, enumNames, err := jItem.enum2Array()
+	if err != nil {
+		return nil, err
+	}
+	kvs.AddReplace(enumNames2KVS(enum, enumNames, fullKey)...)
+	typeKey := joinKey(fullKey, "type")
+	refKvs, ok := option.compositeKVS(jItem, fullKey)
+	if !ok {
+		refKvs, ok = option.mapKVS(jItem, fullKey)
+	}
+	if !ok {
+		refKvs, ok = option.refKVS(jItem.Type, fullKey)
+	}
+	attrKvs := make(kvstruct.KVS, 0, len(kvs))
+	for _, kv := range kvs {
+		switch kv.Key {
+		case joinKey(fullKey, "composition"), joinKey(fullKey, "discriminator"), joinKey(fullKey, "keyPattern"), joinKey(fullKey, "requiredIf"), joinKey(fullKey, "dependentRequired"), joinKey(fullKey, "nullable"): // 仅lineschema 使用,在compositeKVS、mapKVS、conditionKVS、nullableKVS 中转换
+			continue
+		case joinKey(fullKey, "additionalProperties"):
+			if _, isMap := jItem.MapType(); isMap { // map 的additionalProperties 为值类型
+				continue
+			}
+		case typeKey:
+			if ok || kv.Value == TYPE_ANY {
+				continue
+			}
+		case joinKey(fullKey, "const"):
+			kv.Value = jItem.constJSON()
+		}
+		attrKvs = append(attrKvs, kv)
+	}
+	attrKvs.AddReplace(refKvs...)
+	if jItem.Nullable {
+		attrKvs = nullableKVS(attrKvs, fullKey)
+	}
+	return attrKvs, nil
+}
+
+// constJSON const 的json 文本:integer、number、boolean 类型且取值合法时为对应的json 值,否则为json 字符串
+func (jItem LineschemaItem) constJSON() (raw string) {
+	switch normalizeJsonType(jItem.Type) {
+	case "integer", "number":
+		if isJSONNumber(jItem.Const) {
+			return jItem.Const
+		}
+	case "boolean":
+		if jItem.Const == "true" || jItem.Const == "false" {
+			return jItem.Const
+		}
+	}
+	b, _ := json.Marshal(jItem.Const)
+	return string(b)
+}
+
+func containsNil(values []interface{}) bool {
+	for _, v := range values {
+		if v == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// nullableKVS 允许属性为null:有type 时改为[type,"null"],引用、组合类型增加null 分支,enum 增加null
+func nullableKVS(kvs kvstruct.KVS, fullKey string) (nullableKvs kvstruct.KVS) {
+	typeKey, refKey, enumKey := joinKey(fullKey, "type"), joinKey(fullKey, "$ref"), joinKey(fullKey, "enum")
+	hasType := false
+	for _, kv := range kvs {
+		hasType = hasType || kv.Key == typeKey
+	}
+	nullableKvs = make(kvstruct.KVS, 0, len(kvs)+1)
+	variants := map[string]int{}
+	for _, kv := range kvs {
+		switch {
+		case kv.Key == typeKey:
+			kv.Value = fmt.Sprintf(`["%s","null"]`, kv.Value)
+		case kv.Key == enumKey:
+			var enum []interface{}
+			if json.Unmarshal([]byte(kv.Value), &enum) == nil && !containsNil(enum) {
+				b, _ := json.Marshal(append(enum, nil))
+				kv.Value = string(b)
+			}
+		case !hasType && kv.Key == refKey:
+			kv.Key = joinKey(fullKey, "anyOf.0.$ref")
+			variants[COMPOSITION_ANY_OF] = 1
+		case !hasType && strings.HasPrefix(kv.Key, joinKey(fullKey, COMPOSITION_ALL_OF)+"."):
+			kv.Key = joinKey(fullKey, "anyOf.0."+strings.TrimPrefix(strings.TrimPrefix(kv.Key, fullKey), "."))
+			variants[COMPOSITION_ANY_OF] = 1
+		default: // oneOf、anyOf(包括枚举标题) 增加null 分支
+			for _, keyword := range []string{COMPOSITION_ONE_OF, COMPOSITION_ANY_OF} {
+				prefix := joinKey(fullKey, keyword) + "."
+				if strings.HasPrefix(kv.Key, prefix) {
+					index := cast.ToInt(strings.SplitN(strings.TrimPrefix(kv.Key, prefix), ".", 2)[0])
+					if index+1 > variants[keyword] {
+						variants[keyword] = index + 1
+					}
+				}
+			}
+		}
+		nullableKvs = append(nullableKvs, kv)
+	}
+	for _, keyword := range []string{COMPOSITION_ONE_OF, COMPOSITION_ANY_OF} {
+		if n, ok := variants[keyword]; ok {
+			nullableKvs = append(nullableKvs, kvstruct.KV{Key: joinKey(fullKey, fmt.Sprintf("%s.%d.type", keyword, n)), Value: "null"})
+		}
+	}
+	return nullableKvs
+}
+
 func enumNames2KVS(enums []interface{}, enumNames []interface{}, prefix string) (kvs kvstruct.KVS) {
 	kvs = make(kvstruct.KVS, 0)
 	if len(enumNames) < 1 {
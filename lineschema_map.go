@@ -0,0 +1,74 @@
+package lineschema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/suifengpiao14/kvstruct"
+)
+
+// MAP_EXAMPLE_KEY 生成案例时,map 类型使用的键名
+const MAP_EXAMPLE_KEY = "key"
+
+var mapTypeRegexp = regexp.MustCompile(`^map\[string\](.+)$`)
+
+// MapType 解析map 类型,如 map[string]Parameter、map[string][]string,返回值类型
+func (jItem LineschemaItem) MapType() (valueType string, ok bool) {
+	matches := mapTypeRegexp.FindStringSubmatch(jItem.Type)
+	if len(matches) != 2 {
+		return "", false
+	}
+	return matches[1], true
+}
+
+// hasCustomMapType 是否存在值为自定义类型的map,json schema 需通过$defs 引用值类型
+func (ls LineschemaItems) hasCustomMapType() bool {
+	for _, item := range ls {
+		if valueType, ok := item.MapType(); ok {
+			if _, ok := CustomDefineStruct(valueType); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mapKVS map 类型输出为 type=object 及additionalProperties(设置keyPattern 时为patternProperties)
+func (o *jsonSchemaOption) mapKVS(jItem LineschemaItem, fullKey string) (kvs kvstruct.KVS, ok bool) {
+	valueType, ok := jItem.MapType()
+	if !ok {
+		return nil, false
+	}
+	kvs = kvstruct.KVS{{Key: joinKey(fullKey, "type"), Value: "object"}}
+	valueKey := joinKey(fullKey, "additionalProperties")
+	if jItem.KeyPattern != "" {
+		valueKey = joinKey(fullKey, fmt.Sprintf("patternProperties.%s", gjsonPathEscaper.Replace(jItem.KeyPattern)))
+	}
+	if refKvs, ok := o.refKVS(valueType, valueKey); ok {
+		kvs.Add(refKvs...)
+		return kvs, true
+	}
+	if strings.HasPrefix(valueType, "[]") {
+		kvs.Add(kvstruct.KV{Key: joinKey(valueKey, "type"), Value: "array"})
+		valueKey = joinKey(valueKey, "items")
+		valueType = strings.TrimPrefix(valueType, "[]")
+	}
+	kvs.Add(kvstruct.KV{Key: joinKey(valueKey, "type"), Value: valueType})
+	return kvs, true
+}
+
+// mapExampleItem 生成案例时,map 类型转换为以MAP_EXAMPLE_KEY 为键的子属性,案例值为json 对象时保持不变
+func mapExampleItem(item *LineschemaItem) (exampleItem *LineschemaItem) {
+	valueType, ok := item.MapType()
+	if !ok || kvstruct.IsJsonStr(item.Example) {
+		return item
+	}
+	clone := *item
+	clone.Fullname = joinKey(item.Fullname, MAP_EXAMPLE_KEY)
+	clone.Type = valueType
+	clone.KeyPattern = ""
+	clone.Path = ""
+	clone.InitPath()
+	return &clone
+}
@@ -4,61 +4,203 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"regexp"
 	"strings"
+	"unicode"
 
+	"github.com/pkg/errors"
 	"github.com/suifengpiao14/kvstruct"
 )
 
+var (
+	ERROR_UNKNOWN_KEY = errors.New("lineschema unknown key")
+)
+
 const (
-	TOKEN_BEGIN = ','
-	TOKEN_END   = '='
-	EOF         = "\n"
+	TOKEN_BEGIN  = ','
+	TOKEN_END    = '='
+	TOKEN_QUOTE  = '"'
+	TOKEN_ESCAPE = '\\'
+	EOF          = "\n"
+
+	COMMENT_HASH  = "#"
+	COMMENT_SLASH = "//"
 )
 
-// ParseLineschema 解析lineschema
-func ParseLineschema(lineschemaRaw string) (jsonline *Lineschema, err error) {
-	lineschemaRaw = compress(lineschemaRaw)
+// ParseLineschema 解析lineschema,出错时返回*ParseError,开启WithCollectErrors 后返回ParseErrors;
+// 所有属性归入同一个Lineschema,存在多个元数据行时以最后一个为准,多个schema 的文件请使用ParseLineschemas
+func ParseLineschema(lineschemaRaw string, options ...ParseOption) (jsonline *Lineschema, err error) {
+	lineschemas, err := parseLineschemas(lineschemaRaw, false, options...)
+	if err != nil {
+		return nil, err
+	}
+	return lineschemas[0], nil
+}
+
+// ParseLineschemas 解析包含多个schema 的文件(如同时包含id=in、id=out),每个元数据行开始一个新的Lineschema,
+// 第一个元数据行前的属性归入第一个Lineschema
+func ParseLineschemas(lineschemaRaw string, options ...ParseOption) (lineschemas Lineschemas, err error) {
+	return parseLineschemas(lineschemaRaw, true, options...)
+}
+
+// parseLineschemas split 为true 时,遇到新的元数据行开始新的Lineschema,否则覆盖当前Meta
+func parseLineschemas(lineschemaRaw string, split bool, options ...ParseOption) (lineschemas Lineschemas, err error) {
+	option := newParseOption(options...)
 	lines := strings.Split(lineschemaRaw, EOF)
-	jsonline = &Lineschema{
+	jsonline := &Lineschema{
 		Items: make([]*LineschemaItem, 0),
 	}
-	for _, line := range lines {
-		kvs := parserOneLine(line)
-		if IsMetaLine(kvs) {
-			meta, err := kvs2meta(kvs)
-			if err != nil {
-				return nil, err
+	lineschemas = Lineschemas{jsonline}
+	parseErrs := make(ParseErrors, 0)
+	comments := make([]string, 0) // 待关联到下一行的注释
+	for i, line := range lines {
+		meta, item, comment, lineErrs := parseLine(line, option)
+		if len(lineErrs) > 0 {
+			for _, lineErr := range lineErrs {
+				lineErr.Line = i + 1
+				lineErr.Raw = strings.TrimRight(line, "\r")
 			}
+			if !option.collectErrors {
+				return nil, lineErrs[0]
+			}
+			parseErrs = append(parseErrs, lineErrs...)
+			continue
+		}
+		if !option.keepComments {
+			comment = ""
+		}
+		switch {
+		case meta != nil:
+			if split && jsonline.Meta != nil {
+				jsonline = &Lineschema{
+					Items: make([]*LineschemaItem, 0),
+				}
+				lineschemas = append(lineschemas, jsonline)
+			}
+			meta.LeadingComments, meta.TrailingComment = comments, comment
+			comments = make([]string, 0)
 			jsonline.Meta = meta
+		case item != nil:
+			item.LeadingComments, item.TrailingComment = comments, comment
+			comments = make([]string, 0)
+			item.Lineschema = jsonline
+			jsonline.Items = append(jsonline.Items, item)
+		case comment != "":
+			comments = append(comments, comment)
+		}
+	}
+	if len(parseErrs) > 0 {
+		return nil, parseErrs
+	}
+	if len(comments) > 0 {
+		jsonline.EndComments = comments
+	}
+	return lineschemas, nil
+}
+
+// parseLine 解析一行,元数据行返回meta,属性行返回item,空行、注释行均返回nil
+func parseLine(line string, option *parseOption) (meta *Meta, item *LineschemaItem, comment string, errs ParseErrors) {
+	mode := separatorToken
+	if option.strict {
+		mode = separatorKey
+	}
+	pairs, comment, parseErr := parseLinePairs(line, mode)
+	if parseErr != nil {
+		return nil, nil, "", ParseErrors{parseErr}
+	}
+	if len(pairs) == 0 {
+		return nil, nil, comment, nil
+	}
+	isMeta := IsMetaLine(pairs2KVS(pairs))
+	if isMeta && !option.strict { // 元数据行允许任意属性,逗号后紧跟形如键名且带=的文本即视为新属性,保留未定义的属性
+		pairs, comment, parseErr = parseLinePairs(line, separatorAttr)
+		if parseErr != nil {
+			return nil, nil, "", ParseErrors{parseErr}
+		}
+	}
+	if option.strict {
+		if errs = checkUnknownKeys(pairs); len(errs) > 0 {
+			return nil, nil, "", errs
+		}
+	}
+	if isMeta {
+		meta, errs = kvs2meta(pairs)
+		return meta, nil, comment, errs
+	}
+	item, errs = kv2item(pairs)
+	return nil, item, comment, errs
+}
+
+// checkUnknownKeys 检测未知的键,并根据编辑距离给出最接近的已知键
+func checkUnknownKeys(pairs []linePair) (errs ParseErrors) {
+	errs = make(ParseErrors, 0)
+	tokens := getTokens()
+	for _, pair := range pairs {
+		if isToken(pair.Key) {
 			continue
 		}
-		item, err := kv2item(kvs)
-		if err != nil {
-			return nil, err
+		parseErr := newParseError(pair, ERROR_UNKNOWN_KEY)
+		parseErr.Suggestion = suggestToken(pair.Key, tokens)
+		if parseErr.Suggestion != "" {
+			parseErr.Err = errors.WithMessagef(ERROR_UNKNOWN_KEY, "did you mean %q?", parseErr.Suggestion)
 		}
-		// err = validItem(item)
-		// if err != nil {
-		// 	err = errors.WithMessage(err, fmt.Sprintf(" got:%s", line))
-		// 	return nil, err
-		// }
-		item.Lineschema = jsonline
-		jsonline.Items = append(jsonline.Items, item)
+		errs = append(errs, parseErr)
 	}
+	return errs
+}
 
-	return jsonline, nil
+// suggestToken 找出与key 编辑距离最小且足够接近的已知键(允许的距离随键长增加,约为键长的三分之一),
+// 1~2个字符的键误差无法判断,不给出建议;找不到返回空
+func suggestToken(key string, tokens []string) (suggestion string) {
+	lowerKey := strings.ToLower(key)
+	length := len([]rune(key))
+	if length <= 2 {
+		return ""
+	}
+	maxDistance := length / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+	minDistance := maxDistance + 1
+	for _, token := range tokens {
+		distance := editDistance(lowerKey, strings.ToLower(token))
+		if distance < minDistance {
+			minDistance = distance
+			suggestion = token
+		}
+	}
+	return suggestion
 }
 
-func kvs2meta(kvs kvstruct.KVS) (meta *Meta, err error) {
+func kvs2meta(pairs []linePair) (meta *Meta, errs ParseErrors) {
 	meta = new(Meta)
-	jb, err := json.Marshal(kvs.Map())
-	if err != nil {
-		return nil, err
-	}
-	err = json.Unmarshal(jb, meta)
-	if err != nil {
-		return nil, err
+	pairs, meta.Extensions = splitExtensionPairs(pairs)
+	pairs, meta.Attrs = splitUnknownPairs(pairs, getJsonTagname(reflect.TypeOf(meta).Elem()))
+	errs = decodeLinePairs(pairs, meta)
+	return meta, errs
+}
+
+// splitUnknownPairs 分离出不在names 中的属性
+func splitUnknownPairs(pairs []linePair, names []string) (knownPairs []linePair, attrs map[string]string) {
+	knownPairs = make([]linePair, 0, len(pairs))
+	for _, pair := range pairs {
+		known := false
+		for _, name := range names {
+			if pair.Key == name {
+				known = true
+				break
+			}
+		}
+		if known {
+			knownPairs = append(knownPairs, pair)
+			continue
+		}
+		if attrs == nil {
+			attrs = make(map[string]string)
+		}
+		attrs[pair.Key] = pair.Value
 	}
-	return meta, nil
+	return knownPairs, attrs
 }
 
 func IsMetaLine(lineTags kvstruct.KVS) bool {
@@ -82,75 +224,269 @@ func IsMetaLine(lineTags kvstruct.KVS) bool {
 //		}
 //		return nil
 //	}
-func kv2item(kvs kvstruct.KVS) (item *LineschemaItem, err error) {
+func kv2item(pairs []linePair) (item *LineschemaItem, errs ParseErrors) {
 	item = new(LineschemaItem)
-	m := make(map[string]interface{})
-	for k, v := range kvs.Map() {
-		m[k] = v
-	}
+	pairs, item.Extensions = splitExtensionPairs(pairs)
+	pairs = append(pairs, linePair{Key: "type", Value: "string"}) // 增加默认type=string，如果存在则忽略
+	errs = decodeLinePairs(pairs, item)
+	item.InitPath()
+	return item, errs
+}
 
-	jb, err := json.Marshal(m)
-	if err != nil {
-		return nil, err
+// splitExtensionPairs 分离出x-开头的扩展属性
+func splitExtensionPairs(pairs []linePair) (attrPairs []linePair, extensions Extensions) {
+	attrPairs = make([]linePair, 0, len(pairs))
+	for _, pair := range pairs {
+		if !IsExtensionKey(pair.Key) {
+			attrPairs = append(attrPairs, pair)
+			continue
+		}
+		if extensions == nil {
+			extensions = make(Extensions)
+		}
+		extensions[pair.Key] = pair.Value
 	}
-	err = json.Unmarshal(jb, item)
-	if err != nil {
-		return nil, err
+	return attrPairs, extensions
+}
+
+// decodeLinePairs 逐个键值解码到dst,出错时能定位到具体的键
+func decodeLinePairs(pairs []linePair, dst interface{}) (errs ParseErrors) {
+	errs = make(ParseErrors, 0)
+	decoded := make(map[string]bool)
+	for _, pair := range pairs {
+		if decoded[pair.Key] && pair.Column == 0 { // 默认值,已存在则忽略
+			continue
+		}
+		decoded[pair.Key] = true
+		jb, err := json.Marshal(map[string]string{pair.Key: pair.Value})
+		if err != nil {
+			errs = append(errs, newParseError(pair, err))
+			continue
+		}
+		err = json.Unmarshal(jb, dst)
+		if err != nil {
+			errs = append(errs, newParseError(pair, err))
+		}
 	}
-	item.InitPath()
-	return item, nil
+	return errs
 }
 
-func compress(lineschema string) (compressedSchema string) {
-	lineschema = strings.TrimSpace(lineschema)
-	replacer := strings.NewReplacer(" ", "", "\t", "", "\r", "")
-	compressedSchema = replacer.Replace(lineschema)
-	return compressedSchema
+// linePair 一行中的一个键值对,记录键所在的列,便于报错
+type linePair struct {
+	Key    string
+	Value  string
+	Column int // 键在原始行中的列号(按字符计算,从1开始),0 表示非原始行中的内容
 }
 
-// parserOneLine 解析一行数据
-func parserOneLine(line string) (kvs kvstruct.KVS) {
-	line = compress(line)
-	if line == "" {
-		return nil
+func pairs2KVS(pairs []linePair) (kvs kvstruct.KVS) {
+	kvs = make(kvstruct.KVS, 0)
+	for _, pair := range pairs {
+		kv := kvstruct.KV{
+			Key:   pair.Key,
+			Value: pair.Value,
+		}
+		kvs.Add(kv)
 	}
-	ret := make([]string, 0)
-	separated := strings.Split(line, ",")
-	ret = append(ret, separated[0])
+	return kvs
+}
+
+// parseLinePairs 将一行拆分成键值对,只去除分隔符两侧的空白,保留值内部的空白;值以双引号开头时按引号语法解析,支持反斜杠转义;
+// 行首、空白或逗号之后的#或//开始到行尾为注释,通过comment 返回,值中包含空白后的#、//时需加引号;
+// mode 决定逗号何时视为分隔符,见separatorMode
+func parseLinePairs(line string, mode separatorMode) (pairs []linePair, comment string, parseErr *ParseError) {
+	runes := []rune(strings.TrimRight(line, "\r"))
+	n := len(runes)
+	pairs = make([]linePair, 0)
 	i := 0
-	for _, nextTag := range separated[1:] {
-		if isToken(nextTag) {
-			ret = append(ret, nextTag)
+	for {
+		i = skipSpace(runes, i)
+		if i >= n {
+			break
+		}
+		if isCommentStart(runes, i) {
+			comment = strings.TrimSpace(string(runes[i:]))
+			break
+		}
+		begin := i
+		for i < n && runes[i] != TOKEN_END && !isSeparator(runes, i, mode) && !isCommentSeparator(runes, i) && !isCommentStart(runes, i) {
 			i++
-		} else {
-			ret[i] = fmt.Sprintf("%s,%s", ret[i], nextTag)
 		}
-	}
-	kvs = make(kvstruct.KVS, 0)
-	for _, pair := range ret {
-		arr := strings.SplitN(pair, "=", 2)
-		if len(arr) == 1 {
-			arr = append(arr, "true")
+		pair := linePair{
+			Key:    strings.TrimSpace(string(runes[begin:i])),
+			Value:  "true",
+			Column: begin + 1,
 		}
-		k, v := arr[0], arr[1]
-		kv := kvstruct.KV{
-			Key:   k,
-			Value: v,
+		if i < n && runes[i] == TOKEN_END {
+			i = skipSpace(runes, i+1)
+			if i < n && runes[i] == TOKEN_QUOTE {
+				value, next, ok := unquoteValue(runes, i)
+				if !ok {
+					err := errors.New("unterminated quoted value")
+					return nil, "", newParseError(linePair{Key: pair.Key, Value: string(runes[i:]), Column: i + 1}, err)
+				}
+				pair.Value = value
+				i = skipSpace(runes, next)
+				if i < n && runes[i] != TOKEN_BEGIN && !isCommentStart(runes, i) {
+					err := errors.Errorf("unexpected character %q after quoted value", runes[i])
+					return nil, "", newParseError(linePair{Key: pair.Key, Value: string(runes[next:]), Column: i + 1}, err)
+				}
+			} else {
+				valueBegin := i
+				for i < n && !isSeparator(runes, i, mode) && !isCommentSeparator(runes, i) && !isCommentStart(runes, i) {
+					i++
+				}
+				pair.Value = strings.TrimSpace(string(runes[valueBegin:i]))
+			}
+		}
+		pairs = append(pairs, pair)
+		if i < n && runes[i] == TOKEN_BEGIN {
+			i++ // 跳过分隔符
 		}
-		kvs.Add(kv)
 	}
-	// 增加默认type=string，如果存在则忽略
-	kvs.AddIgnore(kvstruct.KV{
-		Key:   "type",
-		Value: "string",
-	})
-	return kvs
+	return pairs, comment, nil
+}
+
+// isCommentStart 判断runes[i] 是否为注释开始:位于行首、空白或逗号之后的#、//
+func isCommentStart(runes []rune, i int) bool {
+	if i > 0 && !unicode.IsSpace(runes[i-1]) && runes[i-1] != TOKEN_BEGIN {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(string(runes[i:]), COMMENT_HASH):
+		return true
+	case strings.HasPrefix(string(runes[i:]), COMMENT_SLASH):
+		return true
+	}
+	return false
+}
+
+// isCommentSeparator 判断runes[i] 是否为注释前的逗号(逗号后跳过空白即为注释),用于结束未加引号的值
+func isCommentSeparator(runes []rune, i int) bool {
+	if runes[i] != TOKEN_BEGIN {
+		return false
+	}
+	j := skipSpace(runes, i+1)
+	return j < len(runes) && isCommentStart(runes, j)
+}
+
+func skipSpace(runes []rune, i int) int {
+	for i < len(runes) && unicode.IsSpace(runes[i]) {
+		i++
+	}
+	return i
+}
+
+// separatorMode 判断逗号是否为属性分隔符的规则
+type separatorMode int
+
+const (
+	separatorToken separatorMode = iota // 逗号后紧跟已知属性名或扩展属性名
+	separatorAttr                       // 同separatorToken,另外逗号后紧跟形如键名且带=的文本(元数据行的自定义属性)
+	separatorKey                        // 逗号后紧跟任意形如键名的文本(严格模式)
+)
+
+// isSeparator 判断runes[i] 是否为属性分隔符
+func isSeparator(runes []rune, i int, mode separatorMode) bool {
+	if runes[i] != TOKEN_BEGIN {
+		return false
+	}
+	rest := string(runes[i+1:])
+	switch mode {
+	case separatorKey:
+		return isKeyLike(rest)
+	case separatorAttr:
+		return isToken(rest) || (isKeyLike(rest) && hasExplicitValue(rest))
+	}
+	return isToken(rest)
+}
+
+// hasExplicitValue 判断s 开头的键名后是否紧跟=
+func hasExplicitValue(s string) bool {
+	index := strings.IndexAny(s, string([]rune{TOKEN_BEGIN, TOKEN_END}))
+	return index > -1 && rune(s[index]) == TOKEN_END
+}
+
+// unquoteValue 解析runes[begin] 处开始的双引号值,返回值内容及结束引号后的下标
+func unquoteValue(runes []rune, begin int) (value string, next int, ok bool) {
+	var w strings.Builder
+	for i := begin + 1; i < len(runes); i++ {
+		r := runes[i]
+		switch r {
+		case TOKEN_QUOTE:
+			return w.String(), i + 1, true
+		case TOKEN_ESCAPE:
+			if i+1 >= len(runes) {
+				return "", 0, false
+			}
+			i++
+			switch runes[i] {
+			case TOKEN_QUOTE, TOKEN_ESCAPE:
+				w.WriteRune(runes[i])
+			case 'n':
+				w.WriteRune('\n')
+			case 'r':
+				w.WriteRune('\r')
+			case 't':
+				w.WriteRune('\t')
+			default: // 非转义字符,原样保留(如正则中的\d)
+				w.WriteRune(TOKEN_ESCAPE)
+				w.WriteRune(runes[i])
+			}
+		default:
+			w.WriteRune(r)
+		}
+	}
+	return "", 0, false
+}
+
+// quoteValue 给值加上双引号并转义
+func quoteValue(value string) (quoted string) {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+	quoted = fmt.Sprintf(`"%s"`, replacer.Replace(value))
+	return quoted
+}
+
+// formatPair 输出一个键值对,值会引起歧义时(包含分隔符、注释符、首尾空白、换行等)自动加引号
+func formatPair(key string, value string) (pair string) {
+	pair = fmt.Sprintf("%s=%s", key, value)
+	if !strings.ContainsAny(value, "\r\n") && isSinglePair(pair, key, value, separatorToken) && isSinglePair(pair, key, value, separatorKey) {
+		return pair
+	}
+	return fmt.Sprintf("%s=%s", key, quoteValue(value))
+}
+
+// isSinglePair 判断pair 是否会被原样解析成一个键值对
+func isSinglePair(pair string, key string, value string, mode separatorMode) bool {
+	pairs, comment, err := parseLinePairs(pair, mode)
+	return err == nil && comment == "" && len(pairs) == 1 && pairs[0].Key == key && pairs[0].Value == value
+}
+
+var keyLikeRegexp = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$-]*$`)
+
+// isKeyLike 判断s 是否以形如键名的文本开头(键名后紧跟=、,或结尾)
+func isKeyLike(s string) (yes bool) {
+	return keyLikeRegexp.MatchString(leadingKey(s))
 }
+
+// leadingKey 获取s 开头到第一个=或,之间的文本
+func leadingKey(s string) (key string) {
+	key = s
+	if index := strings.IndexAny(key, string([]rune{TOKEN_BEGIN, TOKEN_END})); index > -1 {
+		key = key[:index]
+	}
+	key = strings.TrimSpace(key)
+	return key
+}
+
+// isToken 判断s 是否以已知属性名或扩展属性名开头(属性名后紧跟=、,或结尾)
 func isToken(s string) (yes bool) {
+	key := leadingKey(s)
+	if IsExtensionKey(key) {
+		return true
+	}
 	for _, token := range getTokens() {
-		yes = strings.HasPrefix(s, token)
-		if yes {
-			return yes
+		if key == token {
+			return true
 		}
 	}
 	return false
@@ -184,3 +520,82 @@ func getJsonTagname(rt reflect.Type) (jsonNames []string) {
 	}
 	return jsonNames
 }
+
+// ParseError 解析错误,记录出错的行列位置、键值及原始行文本
+type ParseError struct {
+	Line   int    // 行号,从1开始
+	Column int    // 键所在列号,按字符计算,从1开始
+	Key    string // 出错的键
+	Value  string // 出错的值
+	Raw    string // 原始行文本
+	Err    error
+	// Suggestion 严格模式下,未知键的建议键名
+	Suggestion string
+}
+
+func newParseError(pair linePair, err error) (parseErr *ParseError) {
+	return &ParseError{
+		Column: pair.Column,
+		Key:    pair.Key,
+		Value:  pair.Value,
+		Err:    err,
+	}
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d,column %d: %s=%s: %s; got:%s", e.Line, e.Column, e.Key, e.Value, e.Err.Error(), e.Raw)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseErrors 一次解析收集到的全部错误
+type ParseErrors []*ParseError
+
+func (es ParseErrors) Error() string {
+	msgArr := make([]string, 0, len(es))
+	for _, e := range es {
+		msgArr = append(msgArr, e.Error())
+	}
+	return strings.Join(msgArr, EOF)
+}
+
+// ParseOption 解析选项
+type ParseOption func(o *parseOption)
+
+type parseOption struct {
+	collectErrors bool
+	keepComments  bool
+	strict        bool
+}
+
+func newParseOption(options ...ParseOption) (o *parseOption) {
+	o = new(parseOption)
+	for _, option := range options {
+		option(o)
+	}
+	return o
+}
+
+// WithCollectErrors 遇到错误不中断,收集所有行的错误后以ParseErrors 返回
+func WithCollectErrors() ParseOption {
+	return func(o *parseOption) {
+		o.collectErrors = true
+	}
+}
+
+// WithKeepComments 保留注释,注释行关联到其后的属性行(或元数据行),行尾注释关联到当前行,Lineschema.String() 时原样输出
+func WithKeepComments() ParseOption {
+	return func(o *parseOption) {
+		o.keepComments = true
+	}
+}
+
+// WithStrict 严格模式,出现Meta、LineschemaItem 中未定义的键时报错(错误为ERROR_UNKNOWN_KEY),并给出拼写建议;
+// 严格模式下逗号后紧跟形如键名的文本即视为新属性,值中此类逗号需使用引号语法
+func WithStrict() ParseOption {
+	return func(o *parseOption) {
+		o.strict = true
+	}
+}
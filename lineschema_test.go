@@ -1,17 +1,21 @@
 package lineschema_test
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 	"github.com/suifengpiao14/lineschema"
+	"github.com/tidwall/gjson"
+	"github.com/xeipuuv/gojsonschema"
 )
 
 func TestResolveRef(t *testing.T) {
 	ls, err := lineschema.ParseLineschema(packschema)
 	require.NoError(t, err)
-	fs := ls.ResolveRef()
+	fs, err := ls.ResolveRef()
+	require.NoError(t, err)
 	s := fs.String()
 	fmt.Println(s)
 
@@ -20,12 +24,147 @@ func TestResolveRef(t *testing.T) {
 func TestEmptyFullnameResolveRef(t *testing.T) {
 	ls, err := lineschema.ParseLineschema(emptyFullnameSchema)
 	require.NoError(t, err)
-	fs := ls.ResolveRef()
+	fs, err := ls.ResolveRef()
+	require.NoError(t, err)
 	s := fs.String()
 	fmt.Println(s)
 
 }
 
+func TestParseLineschemaError(t *testing.T) {
+	raw := `version=http://json-schema.org/draft-07/schema#,id=in
+fullname=pageIndex,type=int,maximum=abc
+fullname=pageSize,type=int,minimum=1,maxLength=x`
+	_, err := lineschema.ParseLineschema(raw)
+	var parseErr *lineschema.ParseError
+	require.True(t, errors.As(err, &parseErr))
+	require.Equal(t, 2, parseErr.Line)
+	require.Equal(t, 29, parseErr.Column)
+	require.Equal(t, "maximum", parseErr.Key)
+	require.Equal(t, "abc", parseErr.Value)
+
+	_, err = lineschema.ParseLineschema(raw, lineschema.WithCollectErrors())
+	var parseErrs lineschema.ParseErrors
+	require.True(t, errors.As(err, &parseErrs))
+	require.Len(t, parseErrs, 2)
+	require.Equal(t, 3, parseErrs[1].Line)
+	require.Equal(t, "maxLength", parseErrs[1].Key)
+}
+
+func TestParseLineschemaKeepSpace(t *testing.T) {
+	raw := `version=http://json-schema.org/draft-07/schema#,id=in
+fullname = createdAt , title=Order created at,example=2023-01-12 00:00:00, pattern=^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}$`
+	ls, err := lineschema.ParseLineschema(raw)
+	require.NoError(t, err)
+	item := ls.Items[0]
+	require.Equal(t, "createdAt", item.Fullname)
+	require.Equal(t, "Order created at", item.Title)
+	require.Equal(t, "2023-01-12 00:00:00", item.Example)
+	require.Equal(t, `^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}$`, item.Pattern)
+
+	ls2, err := lineschema.ParseLineschema(ls.String())
+	require.NoError(t, err)
+	require.Equal(t, ls.String(), ls2.String())
+}
+
+func TestParseLineschemaQuoted(t *testing.T) {
+	raw := `version=http://json-schema.org/draft-07/schema#,id=in
+fullname=remark,description="a, b=c",title="say \"hi\"",pattern="^\d+,\\$",example=" padded "
+fullname=status,description=a,title b,enum=["required","deleted"]`
+	ls, err := lineschema.ParseLineschema(raw)
+	require.NoError(t, err)
+	require.Equal(t, "a, b=c", ls.Items[0].Description)
+	require.Equal(t, `say "hi"`, ls.Items[0].Title)
+	require.Equal(t, `^\d+,\$`, ls.Items[0].Pattern)
+	require.Equal(t, " padded ", ls.Items[0].Example)
+	require.Equal(t, "a,title b", ls.Items[1].Description)
+	require.Equal(t, `["required","deleted"]`, ls.Items[1].Enum)
+	require.Equal(t, "", ls.Items[1].Title)
+
+	ls2, err := lineschema.ParseLineschema(ls.String())
+	require.NoError(t, err)
+	require.Equal(t, ls.Items[0].Description, ls2.Items[0].Description)
+	require.Equal(t, ls.Items[0].Title, ls2.Items[0].Title)
+	require.Equal(t, ls.Items[0].Pattern, ls2.Items[0].Pattern)
+	require.Equal(t, ls.Items[0].Example, ls2.Items[0].Example)
+	require.Equal(t, ls.Items[1].Description, ls2.Items[1].Description)
+
+	_, err = lineschema.ParseLineschema(`fullname=remark,description="a, b`)
+	require.Error(t, err)
+}
+
+func TestParseLineschemaComments(t *testing.T) {
+	raw := `# 订单查询入参
+version=http://json-schema.org/draft-07/schema#,id=in
+
+// 金额单位:分
+fullname=amount,type=int,title=金额 # 不能为负数
+fullname=remark,title="备注 # 非注释",example=http://example.com/a
+fullname=orderNo,title="Order #5",example=a //b
+fullname=status,example="1", // 状态
+fullname=price,type=int # 价格
+# 文件结束`
+	ls, err := lineschema.ParseLineschema(raw)
+	require.NoError(t, err)
+	require.Len(t, ls.Items, 5)
+	require.Equal(t, "金额", ls.Items[0].Title)
+	require.Equal(t, "备注 # 非注释", ls.Items[1].Title)
+	require.Equal(t, "http://example.com/a", ls.Items[1].Example)
+	require.Equal(t, "Order #5", ls.Items[2].Title)
+	require.Equal(t, "a", ls.Items[2].Example)
+	require.Equal(t, "1", ls.Items[3].Example)
+	require.Equal(t, "int", ls.Items[4].Type)
+	require.Empty(t, ls.Items[0].LeadingComments)
+
+	strict, err := lineschema.ParseLineschema(raw, lineschema.WithStrict())
+	require.NoError(t, err)
+	require.Equal(t, "Order #5", strict.Items[2].Title)
+	require.Equal(t, "int", strict.Items[4].Type)
+	jsonschema, err := strict.JsonSchema()
+	require.NoError(t, err)
+	require.Equal(t, "int", gjson.GetBytes(jsonschema, "properties.price.type").String())
+
+	ls, err = lineschema.ParseLineschema(raw, lineschema.WithKeepComments())
+	require.NoError(t, err)
+	require.Equal(t, []string{"# 订单查询入参"}, ls.Meta.LeadingComments)
+	require.Equal(t, []string{"// 金额单位:分"}, ls.Items[0].LeadingComments)
+	require.Equal(t, "# 不能为负数", ls.Items[0].TrailingComment)
+	require.Equal(t, "//b", ls.Items[2].TrailingComment)
+	require.Equal(t, "// 状态", ls.Items[3].TrailingComment)
+	require.Equal(t, "# 价格", ls.Items[4].TrailingComment)
+	ls.Items[2].Example = "a //b"
+	require.Contains(t, ls.String(), `example="a //b"`)
+	require.Equal(t, []string{"# 文件结束"}, ls.EndComments)
+
+	ls2, err := lineschema.ParseLineschema(ls.String(), lineschema.WithKeepComments())
+	require.NoError(t, err)
+	require.Equal(t, ls.String(), ls2.String())
+}
+
+func TestParseLineschemaStrict(t *testing.T) {
+	raw := `version=http://json-schema.org/draft-07/schema#,id=in
+fullname=name,requried,maxlenght=10,foo=bar`
+	_, err := lineschema.ParseLineschema(raw)
+	require.NoError(t, err)
+
+	_, err = lineschema.ParseLineschema(raw, lineschema.WithStrict(), lineschema.WithCollectErrors())
+	var parseErrs lineschema.ParseErrors
+	require.True(t, errors.As(err, &parseErrs))
+	require.Len(t, parseErrs, 3)
+	require.ErrorIs(t, parseErrs[0], lineschema.ERROR_UNKNOWN_KEY)
+	require.Equal(t, "required", parseErrs[0].Suggestion)
+	require.Equal(t, "maxLength", parseErrs[1].Suggestion)
+	require.Equal(t, "", parseErrs[2].Suggestion)
+	fmt.Println(err)
+
+	_, err = lineschema.ParseLineschema(`version=http://json-schema.org/draft-07/schema#,id=in
+fullname=name,description=a,b,typ=int`, lineschema.WithStrict(), lineschema.WithCollectErrors())
+	require.True(t, errors.As(err, &parseErrs))
+	require.Len(t, parseErrs, 2)
+	require.Equal(t, "", parseErrs[0].Suggestion)
+	require.Equal(t, "type", parseErrs[1].Suggestion)
+}
+
 var emptyFullnameSchema = `
 version=http://json-schema.org/draft-07/schema#,id=out
 fullname=,type=proto,required,allowEmptyValue,title=协议,comment=协议
@@ -109,3 +248,400 @@ fullname=Parameter.scene,required,allowEmptyValue
 fullname=Scripts,type=[]Script,required,allowEmptyValue,title=code脚本集合,comment=code脚本集合
 fullname=Script.language,required,allowEmptyValue,title=前置脚本语言,comment=前置脚本语言
 fullname=Script.script,required,allowEmptyValue,title=前置脚本,comment=前置脚本`
+
+func TestRecursiveResolveRef(t *testing.T) {
+	raw := `version=http://json-schema.org/draft-07/schema#,id=out
+fullname=comments,type=[]Comment,title=评论
+fullname=Comment.content,title=内容,example=hello
+fullname=Comment.replies,type=[]Comment,title=回复`
+	ls, err := lineschema.ParseLineschema(raw)
+	require.NoError(t, err)
+	_, err = ls.ResolveRef()
+	require.True(t, errors.Is(err, lineschema.ERROR_CIRCULAR_REFERENCE))
+
+	fs := ls.ResolveRefWithDepth(2)
+	fullnames := itemFullnames(fs.Items)
+	require.Equal(t, []string{"comments[].content", "comments[].replies[].content"}, fullnames)
+
+	jsonschema, err := ls.JsonSchema()
+	require.NoError(t, err)
+	require.Equal(t, "#/definitions/Comment", gjson.GetBytes(jsonschema, "properties.comments.items.$ref").String())
+	require.Equal(t, "#/definitions/Comment", gjson.GetBytes(jsonschema, "definitions.Comment.properties.replies.items.$ref").String())
+
+	example, err := ls.JsonExample()
+	require.NoError(t, err)
+	require.Equal(t, "hello", gjson.Get(example, "comments.0.replies.0.replies.0.content").String())
+	require.False(t, gjson.Get(example, "comments.0.replies.0.replies.0.replies").Exists())
+}
+
+func TestClosedObjects(t *testing.T) {
+	raw := `version=http://json-schema.org/draft-07/schema#,id=out,additionalProperties=false
+fullname=user,type=User
+fullname=extra,type=object,additionalProperties
+fullname=items[].sku
+fullname=labels,type=map[string]Label
+fullname=User.name
+fullname=User.friends,type=[]User
+fullname=Label.text`
+	ls, err := lineschema.ParseLineschema(raw)
+	require.NoError(t, err)
+	require.Equal(t, "false", ls.Meta.AdditionalProperties)
+	require.Contains(t, ls.String(), "additionalProperties=false")
+
+	jsonschema, err := ls.JsonSchema()
+	require.NoError(t, err)
+	require.Equal(t, "false", gjson.GetBytes(jsonschema, "additionalProperties").Raw)
+	require.Equal(t, "true", gjson.GetBytes(jsonschema, "properties.extra.additionalProperties").Raw)
+	require.Equal(t, "false", gjson.GetBytes(jsonschema, "properties.items.items.additionalProperties").Raw)
+	require.Equal(t, "false", gjson.GetBytes(jsonschema, "definitions.User.additionalProperties").Raw)
+	require.Equal(t, "#/definitions/Label", gjson.GetBytes(jsonschema, "properties.labels.additionalProperties.$ref").String())
+	result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(jsonschema), gojsonschema.NewStringLoader(`{"user":{"name":"a","password":"x"}}`))
+	require.NoError(t, err)
+	require.False(t, result.Valid())
+
+	data := `{"user":{"name":"a","password":"x","friends":[{"name":"b","token":"t"}]},"extra":{"any":1},"items":[{"sku":"s","cost":1}],"labels":{"k":{"text":"t","internal":1}},"secret":1}`
+	stripped, err := ls.StripUnknownFields([]byte(data))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"user":{"name":"a","friends":[{"name":"b"}]},"extra":{"any":1},"items":[{"sku":"s"}],"labels":{"k":{"text":"t"}}}`, string(stripped))
+
+	ls2, err := lineschema.Jsonschema2Lineschema(string(jsonschema))
+	require.NoError(t, err)
+	require.Equal(t, "false", ls2.Meta.AdditionalProperties)
+
+	rootOnly, err := lineschema.Jsonschema2Lineschema(`{"type":"object","additionalProperties":false,"properties":{"user":{"type":"object","properties":{"name":{"type":"string"}}}}}`)
+	require.NoError(t, err)
+	require.Equal(t, "", rootOnly.Meta.AdditionalProperties)
+	jsonschema, err = rootOnly.JsonSchema()
+	require.NoError(t, err)
+	require.False(t, gjson.GetBytes(jsonschema, "properties.user.additionalProperties").Exists())
+}
+
+func TestParseLineschemas(t *testing.T) {
+	raw := `# 请求
+version=http://json-schema.org/draft-07/schema#,id=in
+fullname=pageIndex,type=integer,required
+fullname=pageSize,type=integer,required
+
+# 响应
+version=http://json-schema.org/draft-07/schema#,id=out
+fullname=code,required
+fullname=items[].name,title=名称
+# 结束`
+	lineschemas, err := lineschema.ParseLineschemas(raw, lineschema.WithKeepComments())
+	require.NoError(t, err)
+	require.Len(t, lineschemas, 2)
+	in, ok := lineschemas.GetByID("in")
+	require.True(t, ok)
+	require.Len(t, in.Items, 2)
+	require.Equal(t, []string{"# 请求"}, in.Meta.LeadingComments)
+	out, ok := lineschemas.GetByID("out")
+	require.True(t, ok)
+	require.Len(t, out.Items, 2)
+	require.Equal(t, out, out.Items[1].Lineschema)
+	require.Equal(t, []string{"# 结束"}, out.EndComments)
+	_, ok = lineschemas.GetByID("other")
+	require.False(t, ok)
+
+	lineschemas2, err := lineschema.ParseLineschemas(lineschemas.String(), lineschema.WithKeepComments())
+	require.NoError(t, err)
+	require.Equal(t, lineschemas.String(), lineschemas2.String())
+
+	single, err := lineschema.ParseLineschema(raw)
+	require.NoError(t, err)
+	require.Equal(t, "out", single.Meta.ID)
+	require.Len(t, single.Items, 4)
+}
+
+func TestMetaAttributes(t *testing.T) {
+	raw := `version=http://json-schema.org/draft-07/schema#,id=orderList,direction=out,title=订单列表,description=分页,按时间倒序,module=order,x-table=orders
+fullname=code`
+	ls, err := lineschema.ParseLineschema(raw)
+	require.NoError(t, err)
+	require.Equal(t, "orderList", ls.Meta.ID)
+	require.Equal(t, lineschema.DIRECTION_OUT, ls.Meta.Direction)
+	require.Equal(t, lineschema.DIRECTION_OUT, ls.Meta.GetDirection())
+	require.Equal(t, "订单列表", ls.Meta.Title)
+	require.Equal(t, "分页,按时间倒序", ls.Meta.Description)
+	require.Equal(t, map[string]string{"module": "order"}, ls.Meta.Attrs)
+	require.NoError(t, ls.Validate())
+
+	ls2, err := lineschema.ParseLineschema(ls.String())
+	require.NoError(t, err)
+	require.Equal(t, ls.Meta, ls2.Meta)
+	require.Equal(t, ls.String(), ls2.String())
+
+	jsonschema, err := ls.JsonSchema()
+	require.NoError(t, err)
+	require.Equal(t, "订单列表", gjson.GetBytes(jsonschema, "title").String())
+	ls3, err := lineschema.Jsonschema2Lineschema(string(jsonschema))
+	require.NoError(t, err)
+	require.Equal(t, "分页,按时间倒序", ls3.Meta.Description)
+
+	described, err := lineschema.ParseLineschema(`version=http://json-schema.org/draft-07/schema#,id=in,description=list orders, paginated,module=order`)
+	require.NoError(t, err)
+	require.Equal(t, "list orders, paginated", described.Meta.Description)
+	require.Equal(t, map[string]string{"module": "order"}, described.Meta.Attrs)
+	described2, err := lineschema.ParseLineschema(described.String())
+	require.NoError(t, err)
+	require.Equal(t, described.Meta, described2.Meta)
+
+	described, err = lineschema.ParseLineschema(`version=http://json-schema.org/draft-07/schema#,id=in,description=a,b`)
+	require.NoError(t, err)
+	require.Equal(t, "a,b", described.Meta.Description)
+	require.Empty(t, described.Meta.Attrs)
+
+	in, err := lineschema.ParseLineschema(`version=http://json-schema.org/draft-07/schema#,id=in`)
+	require.NoError(t, err)
+	require.Equal(t, lineschema.DIRECTION_IN, in.Meta.GetDirection())
+
+	in.Meta.Direction = "both"
+	require.Error(t, in.Validate())
+}
+
+func TestCompileValidator(t *testing.T) {
+	cases := []struct {
+		raw  string
+		docs []string
+	}{
+		{
+			raw: `version=http://json-schema.org/draft-07/schema#,id=in
+fullname=pageIndex,type=integer,required,minimum=0
+fullname=pageSize,type=integer,required,minimum=1,maximum=100,exclusiveMaximum
+fullname=keyword,minLength=2,maxLength=4,pattern=^[a-z]+$
+fullname=status,enum=["paid","unpaid"]
+fullname=price,type=number,multipleOf=0.01
+fullname=email,format=email
+fullname=tags,type=array,maxItems=2,uniqueItems
+fullname=tags[],minLength=1
+fullname=needInvoice,type=boolean
+fullname=invoiceTitle,requiredIf={"needInvoice":true}
+fullname=taxNo,dependentRequired=needInvoice
+fullname=remark,nullable`,
+			docs: []string{
+				`{"pageIndex":0,"pageSize":10}`,
+				`{"pageIndex":1.5,"pageSize":10}`,
+				`{"pageIndex":-1,"pageSize":100}`,
+				`{"pageSize":10}`,
+				`{"pageIndex":0,"pageSize":10,"keyword":"abc","status":"paid","price":9.99,"email":"a@b.cn"}`,
+				`{"pageIndex":0,"pageSize":10,"keyword":"a"}`,
+				`{"pageIndex":0,"pageSize":10,"keyword":"ABC"}`,
+				`{"pageIndex":0,"pageSize":10,"status":"refund"}`,
+				`{"pageIndex":0,"pageSize":10,"price":9.999}`,
+				`{"pageIndex":0,"pageSize":10,"email":"abc"}`,
+				`{"pageIndex":0,"pageSize":10,"tags":["a","b","c"]}`,
+				`{"pageIndex":0,"pageSize":10,"tags":["a","a"]}`,
+				`{"pageIndex":0,"pageSize":10,"tags":[""]}`,
+				`{"pageIndex":0,"pageSize":10,"needInvoice":true,"taxNo":"1"}`,
+				`{"pageIndex":0,"pageSize":10,"needInvoice":false,"taxNo":"1"}`,
+				`{"pageIndex":0,"pageSize":10,"needInvoice":false}`,
+				`{"pageIndex":0,"pageSize":10,"remark":null}`,
+				`{"pageIndex":0,"pageSize":10,"keyword":null}`,
+				`[]`,
+			},
+		},
+		{
+			raw: `version=http://json-schema.org/draft-07/schema#,id=out,additionalProperties=false
+fullname=code,type=integer,required
+fullname=data,type=[]Order
+fullname=extra,type=object,additionalProperties=true
+fullname=Order.id,type=integer,required
+fullname=Order.children,type=[]Order
+fullname=Order.payment,type=Card|BankAccount,nullable
+fullname=Order.labels,type=map[string]string
+fullname=Order.point[0],type=number
+fullname=Order.point[1],type=number
+fullname=Card.kind,const=card,required
+fullname=Card.cardNo,required
+fullname=BankAccount.kind,const=bank,required
+fullname=BankAccount.account,required`,
+			docs: []string{
+				`{"code":0}`,
+				`{"code":0,"unknown":1}`,
+				`{"code":0,"extra":{"any":1}}`,
+				`{"code":0,"data":[{"id":1,"children":[{"id":2,"children":[{"id":3}]}]}]}`,
+				`{"code":0,"data":[{"id":1,"children":[{"id":2,"children":[{"name":"x"}]}]}]}`,
+				`{"code":0,"data":[{"id":1,"payment":{"kind":"card","cardNo":"1"}}]}`,
+				`{"code":0,"data":[{"id":1,"payment":{"kind":"bank","account":"1"}}]}`,
+				`{"code":0,"data":[{"id":1,"payment":{"kind":"cash"}}]}`,
+				`{"code":0,"data":[{"id":1,"payment":null}]}`,
+				`{"code":0,"data":[{"id":1,"labels":{"a":"x","b":"y"}}]}`,
+				`{"code":0,"data":[{"id":1,"labels":{"a":1}}]}`,
+				`{"code":0,"data":[{"id":1,"point":[120.1,30.2]}]}`,
+				`{"code":0,"data":[{"id":1,"point":[120.1,"x"]}]}`,
+			},
+		},
+		{
+			raw: `version=http://json-schema.org/draft-07/schema#,id=out
+fullname=[].id,type=integer,required
+fullname=[].name`,
+			docs: []string{
+				`[{"id":1}]`,
+				`[{"id":1,"name":"a"},{"id":2}]`,
+				`[{"name":"a"}]`,
+				`{"id":1}`,
+			},
+		},
+		{
+			raw: `version=http://json-schema.org/draft-07/schema#,id=in
+fullname=p,type=number,maximum=99999999.999999999999
+fullname=q,type=number,minimum=0.1,exclusiveMinimum
+fullname=link,format=uri
+fullname=phone,format=mobile`,
+			docs: []string{
+				`{"p":99999999.999999999999}`,
+				`{"p":100000000}`,
+				`{"q":0.1}`,
+				`{"q":0.10000000000000001}`,
+				`{"link":"urn:isbn:0451450523"}`,
+				`{"phone":"n/a"}`,
+			},
+		},
+		{
+			raw: `version=http://json-schema.org/draft-07/schema#,id=in
+fullname=a,type=integer,const=1
+fullname=b,type=boolean,const=true
+fullname=c,const=1`,
+			docs: []string{
+				`{"a":1}`,
+				`{"a":1.0}`,
+				`{"a":"1"}`,
+				`{"a":2}`,
+				`{"b":true}`,
+				`{"b":"true"}`,
+				`{"c":"1"}`,
+				`{"c":1}`,
+			},
+		},
+	}
+	for _, c := range cases {
+		ls, err := lineschema.ParseLineschema(c.raw)
+		require.NoError(t, err)
+		validator, err := ls.Compile()
+		require.NoError(t, err)
+		jsonschema, err := ls.JsonSchema()
+		require.NoError(t, err)
+		schema, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(jsonschema))
+		require.NoError(t, err)
+		for _, doc := range c.docs {
+			result, err := schema.Validate(gojsonschema.NewStringLoader(doc))
+			require.NoError(t, err)
+			err = validator.Validate([]byte(doc))
+			require.Equal(t, result.Valid(), err == nil, "%s: %v %v", doc, result.Errors(), err)
+			if err != nil {
+				require.True(t, errors.Is(err, lineschema.ERROR_INVALID))
+			}
+		}
+	}
+
+	inferred, err := lineschema.Json2lineSchema(`[{"id":1}]`)
+	require.NoError(t, err)
+	validator, err := inferred.Compile()
+	require.NoError(t, err)
+	require.NoError(t, validator.Validate([]byte(`[{"id":1}]`)))
+
+	bounds, err := lineschema.ParseLineschema(`version=http://json-schema.org/draft-07/schema#,id=in
+fullname=a,type=integer,minimum=1,maximum=9
+fullname=b,type=integer,minimum=1,maximum=9,exclusiveMinimum,exclusiveMaximum`)
+	require.NoError(t, err)
+	validator, err = bounds.Compile()
+	require.NoError(t, err)
+	err = validator.Validate([]byte(`{"a":0,"b":1}`))
+	require.ErrorContains(t, err, "a: must be greater than or equal to 1")
+	require.ErrorContains(t, err, "b: must be greater than 1")
+	err = validator.Validate([]byte(`{"a":10,"b":9}`))
+	require.ErrorContains(t, err, "a: must be less than or equal to 9")
+	require.ErrorContains(t, err, "b: must be less than 9")
+}
+
+func TestCompileValidatorConcurrent(t *testing.T) {
+	ls, err := lineschema.ParseLineschema(validatorBenchSchema)
+	require.NoError(t, err)
+	validator, err := ls.Compile()
+	require.NoError(t, err)
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		go func(valid bool) {
+			doc := validatorBenchDoc
+			if !valid {
+				doc = `{"pageIndex":"x"}`
+			}
+			for j := 0; j < 100; j++ {
+				err := validator.Validate([]byte(doc))
+				if valid != (err == nil) {
+					errs <- fmt.Errorf("doc:%s, err:%v", doc, err)
+					return
+				}
+			}
+			errs <- nil
+		}(i%2 == 0)
+	}
+	for i := 0; i < 8; i++ {
+		require.NoError(t, <-errs)
+	}
+
+	invalid, err := lineschema.ParseLineschema(`version=http://json-schema.org/draft-07/schema#,id=in
+fullname=name,pattern=[`)
+	require.NoError(t, err)
+	_, err = invalid.Compile()
+	require.Error(t, err)
+}
+
+const validatorBenchSchema = `version=http://json-schema.org/draft-07/schema#,id=in
+fullname=pageIndex,type=integer,required,minimum=0
+fullname=pageSize,type=integer,required,minimum=1,maximum=100
+fullname=keyword,maxLength=32
+fullname=status,enum=["paid","unpaid"]
+fullname=filters[].field,required,pattern=^[a-zA-Z]+$
+fullname=filters[].value,required
+fullname=user.id,type=integer,required
+fullname=user.email,format=email`
+
+const validatorBenchDoc = `{"pageIndex":0,"pageSize":20,"keyword":"phone","status":"paid","filters":[{"field":"brand","value":"x"},{"field":"color","value":"red"}],"user":{"id":1,"email":"a@b.cn"}}`
+
+func BenchmarkCompiledValidator(b *testing.B) {
+	ls, err := lineschema.ParseLineschema(validatorBenchSchema)
+	require.NoError(b, err)
+	validator, err := ls.Compile()
+	require.NoError(b, err)
+	data := []byte(validatorBenchDoc)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := validator.Validate(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkGojsonschemaValidate 现有方式:每次调用Validate 时由gojsonschema 编译json schema
+func BenchmarkGojsonschemaValidate(b *testing.B) {
+	ls, err := lineschema.ParseLineschema(validatorBenchSchema)
+	require.NoError(b, err)
+	jsonschema, err := ls.JsonSchema()
+	require.NoError(b, err)
+	loader := gojsonschema.NewBytesLoader(jsonschema)
+	data := []byte(validatorBenchDoc)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := lineschema.Validate(data, loader); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkGojsonschemaPrecompiled gojsonschema 预先编译schema
+func BenchmarkGojsonschemaPrecompiled(b *testing.B) {
+	ls, err := lineschema.ParseLineschema(validatorBenchSchema)
+	require.NoError(b, err)
+	jsonschema, err := ls.JsonSchema()
+	require.NoError(b, err)
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(jsonschema))
+	require.NoError(b, err)
+	data := []byte(validatorBenchDoc)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result, err := schema.Validate(gojsonschema.NewBytesLoader(data))
+		if err != nil || !result.Valid() {
+			b.Fatal(err, result.Errors())
+		}
+	}
+}
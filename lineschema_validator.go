@@ -0,0 +1,644 @@
+package lineschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Validator 由Lineschema.Compile 生成的校验器,直接按LineschemaItem 的约束遍历json,无需转换为json schema;生成后只读,可并发使用
+type Validator struct {
+	root *validatorNode
+}
+
+// validatorNode json 中一个位置的约束,自定义类型共享同一节点,支持递归类型
+type validatorNode struct {
+	typ         string // 归一化后的json 类型,空表示不限制
+	nullable    bool
+	item        *LineschemaItem // 约束来源,隐式节点(如a.b 中的a)为nil
+	properties  map[string]*validatorNode
+	required    []string
+	conditions  []requiredCondition
+	dependents  map[string][]string // 属性存在时,这些同级属性必填
+	closed      bool                // 不允许未定义的属性
+	items       *validatorNode
+	tuple       []*validatorNode
+	mapValue    *validatorNode
+	keyPattern  *regexp.Regexp
+	composition string // allOf、anyOf、oneOf,引用单个自定义类型时为allOf
+	variants    []*validatorNode
+
+	pattern    *regexp.Regexp
+	enum       []gjson.Result
+	constValue *gjson.Result // 与JsonSchema() 输出的const 一致,见constJSON
+	minimum    *big.Rat      // 任意精度,与json schema 中原样输出的数字一致
+	maximum    *big.Rat
+	multipleOf *big.Rat
+}
+
+// requiredCondition requiredIf 转换的条件:同级属性均存在且取值相等时name 必填
+type requiredCondition struct {
+	name   string
+	fields map[string]gjson.Result
+}
+
+func newValidatorNode() *validatorNode {
+	return &validatorNode{properties: make(map[string]*validatorNode)}
+}
+
+// Compile 生成校验器,校验规则与JsonSchema() 输出的json schema 一致;format 与funcs.go 中的Validate 一样通过gojsonschema.FormatCheckers 校验,
+// 未注册的格式(如mobile)不校验,推断时使用的格式识别器(见RegisterFormatDetector)不参与校验
+func (l Lineschema) Compile() (v *Validator, err error) {
+	items, definitions, _ := l.Definitions()
+	c := &validatorCompiler{
+		definitions: definitions,
+		types:       make(map[string]*validatorNode),
+	}
+	if l.Meta != nil && l.Meta.AdditionalProperties == "false" {
+		c.closed = true
+		c.openTypes = l.Items.allOfTypeNames()
+	}
+	root := newValidatorNode()
+	if !items.isRootArray() {
+		root.typ = "object"
+	}
+	err = c.fill(root, items, c.closed)
+	if err != nil {
+		return nil, err
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &Validator{root: root}, nil
+}
+
+// isRootArray 根节点是否为数组(元组),即存在以[ 开头的fullname
+func (ls LineschemaItems) isRootArray() bool {
+	for _, item := range ls {
+		if strings.HasPrefix(strings.Trim(item.Fullname, "."), "[") {
+			return true
+		}
+	}
+	return false
+}
+
+// validatorCompiler 编译过程中的状态
+type validatorCompiler struct {
+	definitions map[string]LineschemaItems
+	types       map[string]*validatorNode
+	closed      bool            // Meta.AdditionalProperties=false
+	openTypes   map[string]bool // allOf 引用的类型不关闭
+	err         error           // 编译自定义类型时的错误
+}
+
+func (c *validatorCompiler) typeNode(name string) (node *validatorNode) {
+	if node, ok := c.types[name]; ok {
+		return node
+	}
+	node = newValidatorNode()
+	c.types[name] = node
+	if err := c.fill(node, c.definitions[name], c.closed && !c.openTypes[name]); err != nil && c.err == nil {
+		c.err = errors.WithMessagef(err, "type:%s", name)
+	}
+	return node
+}
+
+// fill 将属性添加到根节点root 下,closed 为true 时关闭所有对象
+func (c *validatorCompiler) fill(root *validatorNode, items LineschemaItems, closed bool) (err error) {
+	for _, item := range items {
+		parent, node, name := (*validatorNode)(nil), root, ""
+		fullname := strings.Trim(item.Fullname, ".")
+		if fullname != "" {
+			for _, segment := range strings.Split(fullname, ".") {
+				key, suffixes := splitArraySuffix(segment)
+				if key != "" {
+					node.implicitType("object")
+					child, ok := node.properties[key]
+					if !ok {
+						child = newValidatorNode()
+						node.properties[key] = child
+					}
+					parent, node, name = node, child, key
+				}
+				for _, suffix := range suffixes {
+					node.implicitType("array")
+					parent, name = nil, ""
+					if index, ok := tupleIndex(suffix); ok {
+						for len(node.tuple) <= index {
+							node.tuple = append(node.tuple, newValidatorNode())
+						}
+						node = node.tuple[index]
+						continue
+					}
+					if node.items == nil {
+						node.items = newValidatorNode()
+					}
+					node = node.items
+				}
+			}
+		}
+		if parent != nil {
+			err = parent.addCondition(item, name)
+			if err != nil {
+				return err
+			}
+		}
+		if node.item != nil { // fullname 重复,以第一个为准
+			continue
+		}
+		err = c.apply(node, item)
+		if err != nil {
+			return err
+		}
+	}
+	if closed {
+		root.close()
+	}
+	return nil
+}
+
+// implicitType 未定义的中间节点,按路径推断为对象或数组
+func (n *validatorNode) implicitType(typ string) {
+	if n.item == nil && n.typ == "" {
+		n.typ = typ
+	}
+}
+
+// close 关闭未设置additionalProperties 的对象,map、引用节点不处理
+func (n *validatorNode) close() {
+	visited := make(map[*validatorNode]bool)
+	var walk func(node *validatorNode)
+	walk = func(node *validatorNode) {
+		if node == nil || visited[node] {
+			return
+		}
+		visited[node] = true
+		isObject := node.typ == "object" || len(node.properties) > 0
+		if isObject && node.mapValue == nil && (node.item == nil || node.item.AdditionalProperties == "") {
+			node.closed = true
+		}
+		for _, property := range node.properties {
+			walk(property)
+		}
+		walk(node.items)
+		for _, element := range node.tuple {
+			walk(element)
+		}
+		walk(node.mapValue)
+	}
+	walk(n)
+}
+
+// addCondition 属性的required、requiredIf、dependentRequired 记录到父节点
+func (n *validatorNode) addCondition(item *LineschemaItem, name string) (err error) {
+	if item.Required {
+		n.required = append(n.required, name)
+	}
+	if item.RequiredIf != "" {
+		condition, err := item.requiredIfCondition()
+		if err != nil {
+			return err
+		}
+		fields := make(map[string]gjson.Result, len(condition))
+		for field, value := range condition {
+			b, err := json.Marshal(value)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			fields[field] = gjson.ParseBytes(b)
+		}
+		n.conditions = append(n.conditions, requiredCondition{name: name, fields: fields})
+	}
+	if item.DependentRequired != "" {
+		fields, err := item.dependentFields()
+		if err != nil {
+			return err
+		}
+		if n.dependents == nil {
+			n.dependents = make(map[string][]string)
+		}
+		for _, field := range fields {
+			n.dependents[field] = append(n.dependents[field], name)
+		}
+	}
+	return nil
+}
+
+// apply 根据属性的类型、约束设置节点
+func (c *validatorCompiler) apply(node *validatorNode, item *LineschemaItem) (err error) {
+	node.item = item
+	node.nullable = item.Nullable
+	switch item.AdditionalProperties {
+	case "false":
+		node.closed = true
+	case "true":
+		node.closed = false
+	}
+	if item.Pattern != "" {
+		node.pattern, err = regexp.Compile(item.Pattern)
+		if err != nil {
+			return errors.WithMessagef(err, "invalid pattern: %s, fullname:%s", item.Pattern, item.Fullname)
+		}
+	}
+	if item.Const != "" {
+		constValue := gjson.Parse(item.constJSON())
+		node.constValue = &constValue
+	}
+	if item.Enum != "" {
+		enum := gjson.Parse(item.Enum)
+		if !enum.IsArray() {
+			return errors.Errorf("invalid enum: %s, fullname:%s", item.Enum, item.Fullname)
+		}
+		node.enum = enum.Array()
+	}
+	node.minimum, err = parseBound("minimum", item.Minimum)
+	if err != nil {
+		return errors.WithMessagef(err, "fullname:%s", item.Fullname)
+	}
+	node.maximum, err = parseBound("maximum", item.Maximum)
+	if err != nil {
+		return errors.WithMessagef(err, "fullname:%s", item.Fullname)
+	}
+	if item.MultipleOf != "" {
+		multipleOf, ok := new(big.Rat).SetString(item.MultipleOf.String())
+		if !ok || multipleOf.Sign() <= 0 {
+			return errors.Errorf("invalid multipleOf: %s, fullname:%s", item.MultipleOf, item.Fullname)
+		}
+		node.multipleOf = multipleOf
+	}
+	if valueType, ok := item.MapType(); ok {
+		node.typ = "object"
+		if item.KeyPattern != "" {
+			node.keyPattern, err = regexp.Compile(item.KeyPattern)
+			if err != nil {
+				return errors.WithMessagef(err, "invalid keyPattern: %s, fullname:%s", item.KeyPattern, item.Fullname)
+			}
+		}
+		node.mapValue = newValidatorNode()
+		c.applyType(node.mapValue, valueType)
+		return nil
+	}
+	if keyword, typeNames, ok := item.CompositeType(); ok {
+		if strings.HasPrefix(item.Type, "[]") {
+			node.typ = "array"
+			if node.items == nil {
+				node.items = newValidatorNode()
+			}
+			node = node.items
+		}
+		node.composition = keyword
+		for _, name := range typeNames {
+			node.variants = append(node.variants, c.typeNode(name))
+		}
+		return nil
+	}
+	c.applyType(node, item.Type)
+	return nil
+}
+
+// applyType 设置基本类型、数组、自定义类型
+func (c *validatorCompiler) applyType(node *validatorNode, typ string) {
+	for strings.HasPrefix(typ, "[]") {
+		typ = strings.TrimPrefix(typ, "[]")
+		node.typ = "array"
+		if node.items == nil {
+			node.items = newValidatorNode()
+		}
+		node = node.items
+	}
+	if name, ok := CustomDefineStruct(typ); ok {
+		node.typ = ""
+		node.composition = COMPOSITION_ALL_OF
+		node.variants = append(node.variants, c.typeNode(name))
+		return
+	}
+	node.typ = normalizeJsonType(typ)
+}
+
+// normalizeJsonType 将lineschema 中的类型别名(int、float 等)转换为json 类型
+func normalizeJsonType(typ string) string {
+	switch typ {
+	case "int", "integer":
+		return "integer"
+	case "float", "number", "numeber":
+		return "number"
+	case "bool", "boolean":
+		return "boolean"
+	case TYPE_ANY:
+		return ""
+	}
+	return typ
+}
+
+// parseBound 按任意精度解析minimum、maximum
+func parseBound(name string, number json.Number) (bound *big.Rat, err error) {
+	if number == "" {
+		return nil, nil
+	}
+	bound, ok := new(big.Rat).SetString(number.String())
+	if !ok {
+		return nil, errors.Errorf("invalid %s: %s", name, number)
+	}
+	return bound, nil
+}
+
+// Validate 校验json,错误格式与funcs.go 中的Validate 一致
+func (v *Validator) Validate(data []byte) (err error) {
+	if data == nil {
+		return ERROR_VALIDATE_INPUT_NIL
+	}
+	if !gjson.ValidBytes(data) {
+		return errors.WithMessagef(ERROR_INVALID, "400:4000001:input args validate errors:invalid json")
+	}
+	msgArr := make([]string, 0)
+	v.root.validate(gjson.ParseBytes(data), "(root)", &msgArr)
+	if len(msgArr) == 0 {
+		return nil
+	}
+	err = errors.WithMessagef(ERROR_INVALID, "400:4000001:input args validate errors:%s", strings.Join(msgArr, ","))
+	return err
+}
+
+func (n *validatorNode) validate(value gjson.Result, path string, msgArr *[]string) {
+	if value.Type == gjson.Null && (n.nullable || n.typ == "" && len(n.variants) == 0) {
+		return
+	}
+	if n.typ != "" && !matchJsonType(n.typ, value) {
+		*msgArr = append(*msgArr, fmt.Sprintf("%s: invalid type, expected %s", path, n.typ))
+		return
+	}
+	n.validateVariants(value, path, msgArr)
+	n.validateAttrs(value, path, msgArr)
+	switch {
+	case value.IsObject():
+		n.validateObject(value, path, msgArr)
+	case value.IsArray():
+		n.validateArray(value, path, msgArr)
+	}
+}
+
+// validateVariants 校验组合类型、引用的自定义类型
+func (n *validatorNode) validateVariants(value gjson.Result, path string, msgArr *[]string) {
+	if len(n.variants) == 0 {
+		return
+	}
+	if n.composition == COMPOSITION_ALL_OF {
+		for _, variant := range n.variants {
+			variant.validate(value, path, msgArr)
+		}
+		return
+	}
+	matched := 0
+	for _, variant := range n.variants {
+		variantMsgArr := make([]string, 0)
+		variant.validate(value, path, &variantMsgArr)
+		if len(variantMsgArr) == 0 {
+			matched++
+		}
+	}
+	switch {
+	case matched == 0:
+		*msgArr = append(*msgArr, fmt.Sprintf("%s: must match %s schema", path, n.composition))
+	case matched > 1 && n.composition == COMPOSITION_ONE_OF:
+		*msgArr = append(*msgArr, fmt.Sprintf("%s: must match exactly one schema in oneOf", path))
+	}
+}
+
+// validateAttrs 校验enum、const、数字、字符串、数组、对象的约束
+func (n *validatorNode) validateAttrs(value gjson.Result, path string, msgArr *[]string) {
+	addMsg := func(format string, args ...interface{}) {
+		*msgArr = append(*msgArr, fmt.Sprintf("%s: %s", path, fmt.Sprintf(format, args...)))
+	}
+	if n.enum != nil {
+		found := false
+		for _, e := range n.enum {
+			if jsonEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			addMsg("must be one of %s", n.item.Enum)
+		}
+	}
+	if n.item == nil {
+		return
+	}
+	item := n.item
+	if n.constValue != nil && !jsonEqual(*n.constValue, value) {
+		addMsg("must be %s", item.Const)
+	}
+	switch value.Type {
+	case gjson.Number:
+		r, ok := new(big.Rat).SetString(value.Raw)
+		if !ok {
+			break
+		}
+		if n.minimum != nil {
+			switch cmp := r.Cmp(n.minimum); {
+			case item.ExclusiveMinimum && cmp <= 0:
+				addMsg("must be greater than %s", item.Minimum)
+			case cmp < 0:
+				addMsg("must be greater than or equal to %s", item.Minimum)
+			}
+		}
+		if n.maximum != nil {
+			switch cmp := r.Cmp(n.maximum); {
+			case item.ExclusiveMaximum && cmp >= 0:
+				addMsg("must be less than %s", item.Maximum)
+			case cmp > 0:
+				addMsg("must be less than or equal to %s", item.Maximum)
+			}
+		}
+		if n.multipleOf != nil && !new(big.Rat).Quo(r, n.multipleOf).IsInt() {
+			addMsg("must be a multiple of %s", item.MultipleOf)
+		}
+		if item.Format != "" && !gojsonschema.FormatCheckers.IsFormat(item.Format, value.Num) {
+			addMsg("does not match format %s", item.Format)
+		}
+	case gjson.String:
+		length := utf8.RuneCountInString(value.Str)
+		if item.MinLength > 0 && length < item.MinLength {
+			addMsg("length must be greater than or equal to %d", item.MinLength)
+		}
+		if item.MaxLength > 0 && length > item.MaxLength {
+			addMsg("length must be less than or equal to %d", item.MaxLength)
+		}
+		if n.pattern != nil && !n.pattern.MatchString(value.Str) {
+			addMsg("does not match pattern %s", item.Pattern)
+		}
+		if item.Format != "" && !gojsonschema.FormatCheckers.IsFormat(item.Format, value.Str) {
+			addMsg("does not match format %s", item.Format)
+		}
+	}
+}
+
+func (n *validatorNode) validateObject(value gjson.Result, path string, msgArr *[]string) {
+	if n.item == nil && len(n.properties) == 0 && len(n.required) == 0 && n.mapValue == nil && !n.closed {
+		return
+	}
+	count := 0
+	fields := make(map[string]gjson.Result)
+	value.ForEach(func(key, v gjson.Result) bool {
+		count++
+		name := key.String()
+		fields[name] = v
+		subPath := joinKey(strings.TrimPrefix(path, "(root)"), gjsonPathEscaper.Replace(name))
+		if property, ok := n.properties[name]; ok {
+			property.validate(v, subPath, msgArr)
+			return true
+		}
+		if n.mapValue != nil && (n.keyPattern == nil || n.keyPattern.MatchString(name)) {
+			n.mapValue.validate(v, subPath, msgArr)
+			return true
+		}
+		if n.closed {
+			*msgArr = append(*msgArr, fmt.Sprintf("%s: additional property %s is not allowed", path, name))
+		}
+		return true
+	})
+	for _, name := range n.required {
+		if _, ok := fields[name]; !ok {
+			*msgArr = append(*msgArr, fmt.Sprintf("%s: %s is required", path, name))
+		}
+	}
+	for _, condition := range n.conditions {
+		if _, ok := fields[condition.name]; ok || !condition.match(fields) {
+			continue
+		}
+		*msgArr = append(*msgArr, fmt.Sprintf("%s: %s is required", path, condition.name))
+	}
+	for field, names := range n.dependents {
+		if _, ok := fields[field]; !ok {
+			continue
+		}
+		for _, name := range names {
+			if _, ok := fields[name]; !ok {
+				*msgArr = append(*msgArr, fmt.Sprintf("%s: %s is required when %s is present", path, name, field))
+			}
+		}
+	}
+	if n.item == nil {
+		return
+	}
+	if n.item.MinProperties > 0 && count < n.item.MinProperties {
+		*msgArr = append(*msgArr, fmt.Sprintf("%s: must have at least %d properties", path, n.item.MinProperties))
+	}
+	if n.item.MaxProperties > 0 && count > n.item.MaxProperties {
+		*msgArr = append(*msgArr, fmt.Sprintf("%s: must have at most %d properties", path, n.item.MaxProperties))
+	}
+}
+
+// match 条件中的属性均存在且取值相等
+func (c requiredCondition) match(fields map[string]gjson.Result) bool {
+	for field, expected := range c.fields {
+		value, ok := fields[field]
+		if !ok || !jsonEqual(expected, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *validatorNode) validateArray(value gjson.Result, path string, msgArr *[]string) {
+	elements := value.Array()
+	for i, element := range elements {
+		subPath := joinKey(strings.TrimPrefix(path, "(root)"), fmt.Sprintf("%d", i))
+		switch {
+		case i < len(n.tuple):
+			n.tuple[i].validate(element, subPath, msgArr)
+		case n.items != nil:
+			n.items.validate(element, subPath, msgArr)
+		}
+	}
+	if n.item == nil {
+		return
+	}
+	if n.item.MinItems > 0 && len(elements) < n.item.MinItems {
+		*msgArr = append(*msgArr, fmt.Sprintf("%s: must have at least %d items", path, n.item.MinItems))
+	}
+	if n.item.MaxItems > 0 && len(elements) > n.item.MaxItems {
+		*msgArr = append(*msgArr, fmt.Sprintf("%s: must have at most %d items", path, n.item.MaxItems))
+	}
+	if n.item.UniqueItems {
+		for i := range elements {
+			for j := i + 1; j < len(elements); j++ {
+				if jsonEqual(elements[i], elements[j]) {
+					*msgArr = append(*msgArr, fmt.Sprintf("%s: items must be unique", path))
+					return
+				}
+			}
+		}
+	}
+}
+
+// matchJsonType 判断值是否为指定的json 类型,自定义类型等无法识别的类型不限制
+func matchJsonType(typ string, value gjson.Result) bool {
+	switch typ {
+	case "string":
+		return value.Type == gjson.String
+	case "integer":
+		return value.Type == gjson.Number && value.Num == math.Trunc(value.Num) && !math.IsInf(value.Num, 0)
+	case "number":
+		return value.Type == gjson.Number
+	case "boolean":
+		return value.Type == gjson.True || value.Type == gjson.False
+	case "object":
+		return value.IsObject()
+	case "array":
+		return value.IsArray()
+	}
+	return true
+}
+
+// jsonEqual 按json 语义比较两个值,数字按数值比较,对象不区分属性顺序
+func jsonEqual(a gjson.Result, b gjson.Result) bool {
+	switch {
+	case a.Type != b.Type:
+		return false
+	case a.Type == gjson.Number:
+		ra, okA := new(big.Rat).SetString(a.Raw)
+		rb, okB := new(big.Rat).SetString(b.Raw)
+		return okA && okB && ra.Cmp(rb) == 0
+	case a.Type == gjson.String:
+		return a.Str == b.Str
+	case a.IsArray():
+		if !b.IsArray() {
+			return false
+		}
+		arrA, arrB := a.Array(), b.Array()
+		if len(arrA) != len(arrB) {
+			return false
+		}
+		for i := range arrA {
+			if !jsonEqual(arrA[i], arrB[i]) {
+				return false
+			}
+		}
+		return true
+	case a.IsObject():
+		if !b.IsObject() {
+			return false
+		}
+		mapA, mapB := a.Map(), b.Map()
+		if len(mapA) != len(mapB) {
+			return false
+		}
+		for k, v := range mapA {
+			other, ok := mapB[k]
+			if !ok || !jsonEqual(v, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return true // null、true、false
+}
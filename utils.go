@@ -1,9 +1,59 @@
 package lineschema
 
 import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+
+	"github.com/suifengpiao14/kvstruct"
+)
+
+const (
+	EXTENSION_PREFIX = "x-" // 扩展属性前缀
 )
 
+// Extensions 扩展属性(x-开头),原样在lineschema、jsonschema 间传递
+type Extensions map[string]string
+
+// Keys 获取排序后的扩展属性名,保证输出稳定
+func (e Extensions) Keys() (keys []string) {
+	keys = make([]string, 0, len(e))
+	for k := range e {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ToKVS 转换成jsonschema 中的kv,值为json 数组、对象时,按json 写入
+func (e Extensions) ToKVS(namespace string) (kvs kvstruct.KVS) {
+	kvs = make(kvstruct.KVS, 0, len(e))
+	for _, k := range e.Keys() {
+		kv := kvstruct.KV{
+			Key:   strings.Trim(fmt.Sprintf("%s.%s", namespace, k), "."),
+			Value: e[k],
+		}
+		kvs = append(kvs, kv)
+	}
+	return kvs
+}
+
+// pairs 转换成lineschema 中的键值对
+func (e Extensions) pairs() (pairs []string) {
+	pairs = make([]string, 0, len(e))
+	for _, k := range e.Keys() {
+		pairs = append(pairs, formatPair(k, e[k]))
+	}
+	return pairs
+}
+
+// IsExtensionKey 判断是否为扩展属性名
+func IsExtensionKey(key string) bool {
+	return strings.HasPrefix(key, EXTENSION_PREFIX) && len(key) > len(EXTENSION_PREFIX)
+}
+
 // BaseName 获取最后.后的文本
 func BaseName(fullname string) (baseName string) {
 	baseName = fullname
@@ -22,3 +72,64 @@ func Namespace(fullname string) (namespace string) {
 	}
 	return namespace
 }
+
+// editDistance 计算两个字符串的编辑距离(Levenshtein)
+func editDistance(a string, b string) (distance int) {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = prev[j-1] + cost
+			if prev[j]+1 < curr[j] {
+				curr[j] = prev[j] + 1
+			}
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+var jsonNumberRegexp = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// isJSONNumber 判断是否为合法的json 数字文本
+func isJSONNumber(s string) bool {
+	return jsonNumberRegexp.MatchString(s)
+}
+
+var arraySuffixRegexp = regexp.MustCompile(`\[\d*\]$`)
+
+var tupleIndexRegexp = regexp.MustCompile(`\[(\d+)\]`)
+
+// splitArraySuffix 拆分fullname 片段的数组后缀,如 point[0][] 返回 point,["[0]","[]"]
+func splitArraySuffix(segment string) (name string, suffixes []string) {
+	for {
+		loc := arraySuffixRegexp.FindStringIndex(segment)
+		if loc == nil {
+			return segment, suffixes
+		}
+		suffixes = append([]string{segment[loc[0]:]}, suffixes...)
+		segment = segment[:loc[0]]
+	}
+}
+
+// tupleIndex 元组后缀[N] 的位置,数组后缀[] 返回false
+func tupleIndex(suffix string) (index int, ok bool) {
+	matches := tupleIndexRegexp.FindStringSubmatch(suffix)
+	if len(matches) != 2 {
+		return 0, false
+	}
+	index, err := strconv.Atoi(matches[1])
+	return index, err == nil
+}